@@ -0,0 +1,24 @@
+package cached
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// record queues an event for the audit sink. It must be called with fc.m held.
+func (fc *FunctionCache) record(t EventType, key string) {
+	if fc.audit != nil {
+		fc.audits = append(fc.audits, Event{Type: t, Key: key})
+	}
+}
+
+// AuditWriter returns an audit sink for WithAudit writing every event to w as a line
+// of its type and key.
+func AuditWriter(w io.Writer) func(Event) {
+	return func(e Event) {
+		if _, err := fmt.Fprintf(w, "%v %q\n", e.Type, e.Key); err != nil {
+			log.Printf("Writing audit event failed: %v\n", err)
+		}
+	}
+}
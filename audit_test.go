@@ -0,0 +1,74 @@
+package cached
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Test: The audit sink gets every add and removal in order under concurrency
+func TestAuditOrdered(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events []Event
+	fc := NewFunctionCache(ctx, WithMaxSize(10), WithAudit(func(e Event) {
+		// Deliveries are serialized, no lock needed
+		events = append(events, e)
+	}))
+	double := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0].(int) * 2
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				double((g*7 + i) % 50)
+			}
+		}(g)
+	}
+	wg.Wait()
+	fc.Delete(3)
+
+	// Replaying the log must give the final contents
+	present := make(map[string]bool)
+	for _, e := range events {
+		switch e.Type {
+		case EventAdd:
+			if present[e.Key] {
+				t.Fatalf("Key %q added twice without removal", e.Key)
+			}
+			present[e.Key] = true
+		case EventEvict, EventExpire, EventDelete:
+			if !present[e.Key] {
+				t.Fatalf("Key %q removed before it was added", e.Key)
+			}
+			delete(present, e.Key)
+		}
+	}
+	var keys []string
+	for _, info := range fc.ListEntryInfo() {
+		keys = append(keys, info.Key)
+	}
+	if len(present) != len(keys) {
+		t.Errorf("Expected the log to replay to %d entries, got %d", len(keys), len(present))
+	}
+	for _, key := range keys {
+		if !present[key] {
+			t.Errorf("Expected %q in the replayed log", key)
+		}
+	}
+
+	// The writer sink logs one line per event
+	var buf bytes.Buffer
+	AuditWriter(&buf)(Event{Type: EventAdd, Key: "k"})
+	if got := buf.String(); got != "add \"k\"\n" {
+		t.Errorf("Unexpected audit line %q", strings.TrimSpace(got))
+	}
+}
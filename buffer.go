@@ -0,0 +1,42 @@
+package cached
+
+import "sync"
+
+// Buffer holds a private copy of a cached byte slice in a pooled buffer. B may be
+// read and modified freely until Release returns the buffer to the pool, after which
+// it must not be used.
+type Buffer struct {
+	B []byte
+}
+
+// buffers recycles the Buffers handed out by WrapBytes.
+var buffers = sync.Pool{
+	New: func() interface{} {
+		return &Buffer{}
+	},
+}
+
+// Release returns the buffer to the pool for reuse by later calls.
+func (b *Buffer) Release() {
+	b.B = b.B[:0]
+	buffers.Put(b)
+}
+
+// WrapBytes creates a cached version of a function returning a byte slice, which
+// hands every caller a copy of the cached value in a pooled Buffer. Mutating the copy
+// cannot corrupt the cache, and callers releasing their buffers spare an allocation
+// per call once the pool has warmed up.
+func (fc *FunctionCache) WrapBytes(f func(args ...interface{}) []byte) func(args ...interface{}) *Buffer {
+	if f == nil {
+		panic("cached: WrapBytes called with a nil function")
+	}
+	cached := fc.Wrap(func(args ...interface{}) interface{} {
+		return f(args...)
+	})
+	return func(args ...interface{}) *Buffer {
+		data, _ := cached(args...).([]byte)
+		buf := buffers.Get().(*Buffer)
+		buf.B = append(buf.B[:0], data...)
+		return buf
+	}
+}
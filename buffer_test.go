@@ -0,0 +1,64 @@
+package cached
+
+import (
+	"context"
+	"testing"
+)
+
+// Test: Every call gets a private copy of the cached bytes
+func TestWrapBytes(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	load := fc.WrapBytes(func(args ...interface{}) []byte {
+		calls++
+		return []byte("payload")
+	})
+
+	first := load("k")
+	first.B[0] = 'X'
+	second := load("k")
+	if string(second.B) != "payload" || calls != 1 {
+		t.Errorf("Expected an unmodified cached copy, got %q after %d calls", second.B, calls)
+	}
+	first.Release()
+	second.Release()
+	if third := load("k"); string(third.B) != "payload" {
+		t.Errorf("Expected a reused buffer to hold the value, got %q", third.B)
+	}
+}
+
+// Benchmark: hits of a byte slice value copied into fresh slices and pooled buffers
+func BenchmarkBytesHits(b *testing.B) {
+	payload := make([]byte, 4096)
+	f := func(args ...interface{}) []byte {
+		return payload
+	}
+
+	b.Run("copy", func(b *testing.B) {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cachedFunc := NewFunctionCache(ctx).Wrap(func(args ...interface{}) interface{} {
+			return f(args...)
+		})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data := cachedFunc("k").([]byte)
+			_ = append([]byte(nil), data...)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cachedFunc := NewFunctionCache(ctx).WrapBytes(f)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cachedFunc("k").Release()
+		}
+	})
+}
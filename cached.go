@@ -1,17 +1,27 @@
 package cached
 
 import (
+	"container/list"
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"log"
 	"os"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// debug enables logging and the internal lock diagnostics. It is atomic as it is read
+// on every lock acquisition while tests switch it.
+var debug atomic.Bool
+
 func init() {
-	if os.Getenv("DEBUG") == "" {
+	debug.Store(os.Getenv("DEBUG") != "")
+	if !debug.Load() {
 		log.SetOutput(io.Discard)
 	}
 }
@@ -27,134 +37,875 @@ var (
 
 var cached = NewFunctionCache(context.Background())
 
+// bustPrefix separates busting computations from regular ones in the in-flight group
+const bustPrefix = "bust:"
+
 // FunctionCache is a structure that holds the cache, entry time, in-flight requests, and mutexes for synchronization.
 type FunctionCache struct {
-	m        sync.Mutex
-	cache    map[string]interface{}
-	entry    map[string]time.Time
-	inflight map[string]bool
-	mutex    map[string]*sync.Mutex
-	cond     map[string]*sync.Cond
-	waits    map[string]int
+	m             sync.Mutex
+	cache         map[string]interface{}
+	entry         map[string]time.Time
+	group         *Group
+	seen          map[string]int
+	keyFunc       func(args ...interface{}) string
+	jsonKeys      bool
+	typedKeys     bool
+	maxKeyLen     int
+	timeout       time.Duration
+	fallback      func(args ...interface{}) interface{}
+	latency       histogram
+	path          string
+	pinned        map[string]bool
+	weakValues    bool
+	partition     func(args ...interface{}) string
+	partSizes     map[string]int
+	window        int
+	windowMisses  int
+	missWarnings  atomic.Int64
+	equal         func(a, b interface{}) bool
+	normalize     func(string) string
+	transform     func(args []interface{}) []interface{}
+	onCompute     func(key string, value interface{}, dur time.Duration)
+	workers       int
+	noDedup       bool
+	keyArgs       []int
+	idempotent    bool
+	audit         func(Event)
+	audits        []Event
+	auditM        sync.Mutex
+	states        map[string]entryState
+	sentinel      func(interface{}) bool
+	sources       map[string]Source
+	minResidency  time.Duration
+	accesses      []string
+	nextAccess    int
+	canonical     func(interface{}) interface{}
+	maxValueBytes int
+	oversized     atomic.Int64
+	setKeepsOrder bool
+	deps          map[string][]string
+	paused        int
+	foldTail      bool
+	foldFrom      int
+	tinyLFU       bool
+	sketch        *sketch
+	expiryWorkers int
+	setWakes      bool
+	setSupersedes bool
+	saver         Saver
+	saveEvery     time.Duration
+	dirty         map[string]interface{}
+	syncM         sync.Mutex
+	saved         chan struct{}
+	jobs          chan func()
+	maxNegatives  int
+	negs          map[string]bool
+	admission     int
+	policy        EvictionPolicy
+	order         *list.List
+	elems         map[string]*list.Element
+	uses          map[string]int
+	accessed      map[string]time.Time
+	maxSize       int
+	ttl           time.Duration
+	ttls          map[string]time.Duration
+	guard         func() interface{}
+	stale         map[string]interface{}
+	staleTime     map[string]time.Time
+	keepStale     bool
+	interval      time.Duration
+	waiters       int
+	recursion     bool
+	batch         int
+	hits          atomic.Int64
+	misses        atomic.Int64
+	evictions     atomic.Int64
+	inserts       atomic.Int64
+	fullInserts   atomic.Int64
+	expired       atomic.Int64
+	last          map[string]interface{}
+	lastTime      map[string]time.Time
+	lazy          bool
+	flush         time.Duration
+	encoder       func(interface{}) (interface{}, error)
+	decoder       func(interface{}) (interface{}, error)
+	sizeFunc      func(interface{}) int
+	sizes         map[string]int
+	bytes         int64
+	subs          map[int]chan Event
+	nextSub       int
+	drops         atomic.Int64
+	pending       []removed
+	onEvict       func(key string, value interface{})
+	bypass        map[reflect.Type]bool
+	onMiss        func() interface{}
+	limiter       *tokenBucket
+	rejectLimited bool
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+	invalidate    <-chan string
+	match         func(key, event string) bool
+}
+
+// newTicker creates the ticker driving the expiration sweeps, returning its channel
+// and stop function. Tests replace it with a fake clock.
+var newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
 }
 
 // NewFunctionCache creates a new FunctionCache instance.
-func NewFunctionCache(ctx context.Context) *FunctionCache {
+func NewFunctionCache(ctx context.Context, opts ...Option) *FunctionCache {
 	fc := &FunctionCache{
-		cache:    make(map[string]interface{}),
-		entry:    make(map[string]time.Time),
-		inflight: make(map[string]bool),
-		mutex:    make(map[string]*sync.Mutex),
-		cond:     make(map[string]*sync.Cond),
-		waits:    make(map[string]int),
+		cache:     make(map[string]interface{}),
+		entry:     make(map[string]time.Time),
+		group:     NewGroup(),
+		seen:      make(map[string]int),
+		order:     list.New(),
+		elems:     make(map[string]*list.Element),
+		uses:      make(map[string]int),
+		accessed:  make(map[string]time.Time),
+		ttls:      make(map[string]time.Duration),
+		pinned:    make(map[string]bool),
+		partSizes: make(map[string]int),
+		negs:      make(map[string]bool),
+		sources:   make(map[string]Source),
+		deps:      make(map[string][]string),
+		stale:     make(map[string]interface{}),
+		staleTime: make(map[string]time.Time),
+		sizes:     make(map[string]int),
+		subs:      make(map[int]chan Event),
+		sizeFunc:  DefaultSize,
+		last:      make(map[string]interface{}),
+		lastTime:  make(map[string]time.Time),
+		done:      make(chan struct{}),
+		recursion: true,
+	}
+	for _, opt := range opts {
+		opt(fc)
+	}
+	if fc.tinyLFU {
+		fc.sketch = newSketch(fc.capacity())
 	}
 
 	// Feature 3. Expiration of the cache
+	ctx, fc.cancel = context.WithCancel(ctx)
+	fc.ctx = ctx
+	if fc.flush > 0 {
+		go fc.flushEvery(ctx, fc.flush)
+	}
+	if fc.saver != nil {
+		go fc.writeBackEvery(ctx, fc.saveEvery)
+	}
+	if fc.invalidate != nil {
+		go fc.invalidateOn(ctx, fc.invalidate, fc.match)
+	}
+	for i := 0; i < fc.workers; i++ {
+		go fc.work(ctx)
+	}
+	if fc.lazy {
+		// Entries expire on read or through ExpireNow only
+		close(fc.done)
+		return fc
+	}
+	// Sweeps follow a ticker, which drops ticks while a sweep overruns instead of drifting
+	tick, stop := newTicker(CacheExpirySleepTime)
 	go func(ctx context.Context) {
+		defer close(fc.done)
+		defer stop()
 		for {
-			if ctx.Err() != nil {
+			select {
+			case <-ctx.Done():
 				return
+			case <-tick:
 			}
-			time.Sleep(CacheExpirySleepTime)
-			fc.m.Lock()
-			for k, t := range fc.entry {
-				if time.Since(t) > CacheExpiryTime {
-					delete(fc.cache, k)
-					delete(fc.entry, k)
-				}
-			}
-			fc.m.Unlock()
+			fc.lock()
+			fc.sweep()
+			fc.unlock()
 		}
 	}(ctx)
 
 	return fc
 }
 
+// Close stops the expiration goroutine and waits for it to exit, and cancels the
+// context of background computations, whose results are then not stored. Write-back
+// caches then write their pending entries and persistent caches their snapshot.
+func (fc *FunctionCache) Close() {
+	fc.cancel()
+	<-fc.done
+	if fc.saver != nil {
+		<-fc.saved
+		if err := fc.Sync(); err != nil {
+			log.Printf("Writing back pending entries failed: %v\n", err)
+		}
+	}
+	if fc.path != "" {
+		if err := fc.save(fc.path); err != nil {
+			log.Printf("Writing cache snapshot failed: %v, %v\n", fc.path, err)
+		}
+	}
+}
+
+// Running reports whether the expiration goroutine is still active.
+func (fc *FunctionCache) Running() bool {
+	select {
+	case <-fc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Delete removes the entry for the given arguments.
+func (fc *FunctionCache) Delete(args ...interface{}) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return
+	}
+	fc.deleteKey(key)
+}
+
+// deleteKey removes the entry stored under key.
+func (fc *FunctionCache) deleteKey(key string) {
+	fc.lock()
+	defer fc.unlock()
+	fc.remove(key)
+}
+
+// Forget drops the in-flight state of the given arguments, so that the next call
+// starts its own computation instead of waiting for a stuck one. Callers already
+// waiting still get the result of the old computation, which is also still stored
+// when it completes: whichever computation finishes last leaves its result cached.
+func (fc *FunctionCache) Forget(args ...interface{}) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return
+	}
+	fc.group.Forget(key)
+}
+
+// Clear removes all entries.
+func (fc *FunctionCache) Clear() {
+	fc.lock()
+	defer fc.unlock()
+	fc.each(fc.remove)
+}
+
 // NewCachedFunction creates a cached version of the given function with memoization, in-flight request deduplication, and expiration.
+// It panics if f is nil, as do all other wrappers.
 func NewCachedFunction(f func(args ...interface{}) interface{}) func(args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: NewCachedFunction called with a nil function")
+	}
 	return func(args ...interface{}) interface{} {
-		key := fmt.Sprintf("%v", args)
-
-		// Feature 4. Capacity limit
-		cached.m.Lock()
-		if len(cached.cache) >= MaxCacheSize {
-			// Remove the oldest entry making new slot available
-			var oldestKey string
-			var oldestTime time.Time
-			for k, t := range cached.entry {
-				if oldestTime.IsZero() || t.Before(oldestTime) {
-					oldestKey = k
-					oldestTime = t
-				}
-			}
-			delete(cached.cache, oldestKey)
-			delete(cached.entry, oldestKey)
-			log.Printf("Evicted oldest entry: %v, cache size: %d\n", oldestKey, len(cached.cache))
+		return cached.call(f, cached.transformed(args))
+	}
+}
+
+// Wrap creates a cached version of the given function backed by this cache instance.
+func (fc *FunctionCache) Wrap(f func(args ...interface{}) interface{}) func(args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: Wrap called with a nil function")
+	}
+	return func(args ...interface{}) interface{} {
+		return fc.call(f, fc.transformed(args))
+	}
+}
+
+// WrapReporting creates a cached version of the given function which also reports
+// whether the result was served without computing it. Callers that waited for another
+// caller's in-flight computation report true as well.
+func (fc *FunctionCache) WrapReporting(f func(args ...interface{}) interface{}) func(args ...interface{}) (interface{}, bool) {
+	if f == nil {
+		panic("cached: WrapReporting called with a nil function")
+	}
+	return func(args ...interface{}) (interface{}, bool) {
+		args = fc.transformed(args)
+		result, hit, err := fc.doReport(args, func() (interface{}, error) {
+			return f(args...), nil
+		})
+		var kerr *KeyError
+		if errors.Is(err, ErrTooManyWaiters) || errors.Is(err, ErrRecursiveCall) || errors.As(err, &kerr) {
+			return f(args...), false
+		}
+		return result, hit
+	}
+}
+
+// WrapE creates a cached version of a function that may fail. Only successful
+// results are cached, errors are returned to the caller and all its waiters.
+func (fc *FunctionCache) WrapE(f func(args ...interface{}) (interface{}, error)) func(args ...interface{}) (interface{}, error) {
+	if f == nil {
+		panic("cached: WrapE called with a nil function")
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		args = fc.transformed(args)
+		return fc.do(args, func() (interface{}, error) {
+			return f(args...)
+		})
+	}
+}
+
+// WrapBust creates a variant of the given function that ignores any cached value,
+// recomputes it and stores the fresh result, for "bust then populate" call sites.
+// Concurrent bust calls for the same arguments are deduplicated. Normal readers keep
+// getting the old value until the fresh one is stored and the new value afterwards.
+func (fc *FunctionCache) WrapBust(f func(args ...interface{}) interface{}) func(args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: WrapBust called with a nil function")
+	}
+	return func(args ...interface{}) interface{} {
+		args = fc.transformed(args)
+		key, err := fc.key(args)
+		if err != nil {
+			log.Printf("Warning: %v, computing uncached\n", err)
+			return f(args...)
 		}
-		cached.m.Unlock()
+		result, _, _ := fc.group.do(bustPrefix+key, fc.waiters, fc.recursion, func() (interface{}, error) {
+			log.Printf("Busting cache: %v\n", key)
+			return fc.compute(key, func() (interface{}, error) {
+				return f(args...), nil
+			})
+		})
+		return result
+	}
+}
+
+// GetOrCompute returns the value cached for the given arguments, computing it with f
+// on a miss, for call sites where the computation is only known at call time. Callers
+// waiting for an in-flight computation get its result, whatever f they supplied.
+func (fc *FunctionCache) GetOrCompute(f func() interface{}, args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: GetOrCompute called with a nil function")
+	}
+	return fc.call(func(...interface{}) interface{} {
+		return f()
+	}, fc.transformed(args))
+}
+
+// GetFresherThan is GetOrCompute for callers which only accept a cached value stored
+// less than maxAge ago. An older entry is recomputed with f and replaced, like
+// WrapBust does, while other callers keep getting it until then. Concurrent
+// recomputations are deduplicated.
+func (fc *FunctionCache) GetFresherThan(maxAge time.Duration, f func() interface{}, args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: GetFresherThan called with a nil function")
+	}
+	args = fc.transformed(args)
+	key, err := fc.key(args)
+	if err != nil {
+		log.Printf("Warning: %v, computing uncached\n", err)
+		return f()
+	}
+	compute := func(...interface{}) interface{} {
+		return f()
+	}
+
+	fc.lock()
+	stored, found := fc.entry[key]
+	fc.unlock()
+	if !found || time.Since(stored) < maxAge {
+		return fc.call(compute, args)
+	}
+	result, _, _ := fc.group.do(bustPrefix+key, fc.waiters, fc.recursion, func() (interface{}, error) {
+		log.Printf("Entry older than %v, recomputing: %v\n", maxAge, key)
+		return fc.compute(key, func() (interface{}, error) {
+			return f(), nil
+		})
+	})
+	return result
+}
 
-		// Feature 1. Memoization
-		cached.m.Lock()
-		if result, found := cached.cache[key]; found {
+// key builds the cache key for the given arguments.
+func (fc *FunctionCache) key(args []interface{}) (string, error) {
+	part := args
+	args = fc.selected(args)
+	if fc.normalize != nil || fc.canonical != nil {
+		args = fc.normalized(args)
+	}
+	args = fc.folded(args)
+	var key string
+	switch {
+	case fc.keyFunc != nil:
+		key = fc.keyFunc(args...)
+	case fc.jsonKeys:
+		var err error
+		if key, err = JSONKey(args...); err != nil {
+			return "", &KeyError{Err: err}
+		}
+	case fc.typedKeys:
+		key = TypedKey(args...)
+	default:
+		key = DefaultKey(args...)
+	}
+	if fc.maxKeyLen > 0 && len(key) > fc.maxKeyLen {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+	if fc.partition != nil {
+		key = fc.partition(part...) + partitionSep + key
+	}
+	return key, nil
+}
+
+// call runs f through the cache using the given arguments.
+func (fc *FunctionCache) call(f func(args ...interface{}) interface{}, args []interface{}) interface{} {
+	return fc.callContext(context.Background(), func(_ context.Context, args ...interface{}) interface{} {
+		return f(args...)
+	}, args)
+}
+
+// callContext runs f taking a context through the cache using the given arguments.
+func (fc *FunctionCache) callContext(ctx context.Context, f func(ctx context.Context, args ...interface{}) interface{}, args []interface{}) interface{} {
+	result, _, err := fc.doContext(ctx, args, func(ctx context.Context) (interface{}, error) {
+		return f(ctx, args...), nil
+	})
+	if errors.Is(err, ErrTooManyWaiters) || errors.Is(err, ErrRecursiveCall) {
+		// Plain functions cannot report the error, compute independently instead
+		return f(ctx, args...)
+	}
+	var kerr *KeyError
+	if errors.As(err, &kerr) {
+		log.Printf("Warning: %v, computing uncached\n", err)
+		return f(ctx, args...)
+	}
+	if err != nil {
+		log.Printf("No result available, returning default: %v\n", err)
+		return fc.defaultResult()
+	}
+	return result
+}
+
+// defaultResult returns the value of plain functions when waiting yielded no result.
+func (fc *FunctionCache) defaultResult() interface{} {
+	if fc.onMiss == nil {
+		return nil
+	}
+	return fc.onMiss()
+}
+
+// do runs compute through the cache using the key of the given arguments.
+func (fc *FunctionCache) do(args []interface{}, compute func() (interface{}, error)) (interface{}, error) {
+	result, _, err := fc.doReport(args, compute)
+	return result, err
+}
+
+// doReport is do additionally reporting whether the result was served without computing it.
+func (fc *FunctionCache) doReport(args []interface{}, compute func() (interface{}, error)) (interface{}, bool, error) {
+	return fc.doContext(context.Background(), args, func(context.Context) (interface{}, error) {
+		return compute()
+	})
+}
+
+// doContext is doReport for a computation taking a context. Computations made for the
+// caller get ctx, background computations a context detached from it, see detach.
+func (fc *FunctionCache) doContext(ctx context.Context, args []interface{}, computeCtx func(ctx context.Context) (interface{}, error)) (interface{}, bool, error) {
+	compute := func() (interface{}, error) {
+		return computeCtx(ctx)
+	}
+	if fc.uncacheable(fc.selected(args)) || fc.missingKey(args) {
+		result, err := compute()
+		return result, false, err
+	}
+
+	// The key is built before any lock is taken, so slow key functions only delay their own caller
+	key, err := fc.key(args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Feature 1. Memoization
+	fc.lock()
+	result, found := fc.lookup(key)
+	refresh := false
+	if found {
+		fc.hits.Add(1)
+		fc.publish(EventHit, key)
+		fc.touch(key)
+		refresh = fc.revalidate(key)
+	} else {
+		fc.misses.Add(1)
+		fc.publish(EventMiss, key)
+	}
+	fc.watchMissRate(found, key)
+	fc.sample(key)
+	if fc.sketch != nil {
+		fc.sketch.add(key)
+	}
+	fc.unlock()
+	if refresh {
+		spawned := fc.spawn(func() {
+			compute, cancel := fc.detach(ctx, computeCtx)
+			defer cancel()
+			fc.refresh(key, compute)
+		})
+		if !spawned {
+			// The next reader retries, the entry must not stay refreshing forever
+			fc.lock()
+			fc.unrefresh(key)
+			fc.unlock()
+		}
+	}
+	if found {
+		if result, err := fc.decode(result); err == nil {
 			log.Printf("Cache hit: %v -> %v\n", key, result)
-			cached.m.Unlock()
-			return result
-		}
-		cached.m.Unlock()
-
-		// Feature 2. In-Flight Request Deduplication - register waiter
-		cached.m.Lock()
-		if _, found := cached.inflight[key]; found {
-			cached.cond[key].L.Lock()
-			cached.waits[key]++
-			log.Printf("Waiting for slot: %v, waits: %d\n", key, cached.waits[key])
-			cached.m.Unlock()
-			cached.cond[key].Wait()
-			cached.cond[key].L.Unlock()
-			cached.m.Lock()
-			if result, found := cached.cache[key]; found {
-				log.Printf("Cache hit after waiting: %v -> %v\n", key, result)
-				cached.m.Unlock()
-				return result
+			return result, true, nil
+		}
+	}
+
+	// Serve the fallback right away and let the real value replace it in the background
+	if fc.fallback != nil {
+		fc.spawn(func() {
+			compute, cancel := fc.detach(ctx, computeCtx)
+			defer cancel()
+			fc.background(key, compute)
+		})
+		log.Printf("Serving fallback on miss: %v\n", key)
+		return fc.fallback(args...), false, nil
+	}
+
+	// Cheap functions are just computed by every caller, the last one stores its result
+	if fc.noDedup {
+		return fc.lead(key, compute)
+	}
+
+	// Feature 2. In-Flight Request Deduplication
+	var hit bool
+	result, err, shared := fc.group.do(key, fc.waiters, fc.recursion, func() (interface{}, error) {
+		var result interface{}
+		var err error
+		result, hit, err = fc.lead(key, compute)
+		return result, err
+	})
+	if shared {
+		log.Printf("Cache hit after waiting: %v -> %v\n", key, result)
+		return result, true, err
+	}
+
+	// Return the result with time stamp of it
+	log.Printf("Returning result: %v -> %v\n", key, result)
+	return result, hit, err
+}
+
+// background computes and stores the result of key without a caller waiting for it.
+func (fc *FunctionCache) background(key string, compute func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Background computation panicked: %v, %v\n", key, r)
+		}
+	}()
+	_, err, _ := fc.group.do(key, fc.waiters, fc.recursion, func() (interface{}, error) {
+		result, _, err := fc.lead(key, compute)
+		return result, err
+	})
+	if err != nil {
+		log.Printf("Background computation failed: %v, %v\n", key, err)
+	}
+}
+
+// lead computes and stores the result of key as the in-flight leader, reporting
+// whether the result was served without calling compute.
+func (fc *FunctionCache) lead(key string, compute func() (interface{}, error)) (interface{}, bool, error) {
+	// A leader that finished just before this one registered may have stored the result already
+	fc.lock()
+	if result, found := fc.lookup(key); found {
+		fc.unlock()
+		if result, err := fc.decode(result); err == nil {
+			return result, true, nil
+		}
+		fc.lock()
+	}
+	if fc.admission > 0 {
+		fc.seen[key]++
+	}
+	// The key was recomputed too recently, serve the last value instead
+	if t, found := fc.lastTime[key]; found && time.Since(t) < fc.interval {
+		result := fc.last[key]
+		fc.unlock()
+		log.Printf("Recompute suppressed: %v -> %v\n", key, result)
+		return result, true, nil
+	}
+	fc.unlock()
+
+	result, err := fc.compute(key, compute)
+	return result, false, err
+}
+
+// compute calls compute and stores its result under key.
+func (fc *FunctionCache) compute(key string, compute func() (interface{}, error)) (interface{}, error) {
+	if err := fc.throttle(); err != nil {
+		log.Printf("Computation rate limited: %v\n", key)
+		return nil, err
+	}
+
+	var token interface{}
+	if fc.guard != nil {
+		token = fc.guard()
+	}
+
+	// Call the original function
+	log.Printf("Calling original function: %v\n", key)
+	start := time.Now()
+	result, err := fc.run(compute)
+	elapsed := time.Since(start)
+	fc.latency.record(elapsed)
+	log.Printf("Original function result: %v -> %v, %v\n", key, result, err)
+	if err != nil {
+		return fc.staleOnError(key, err)
+	}
+	if fc.onCompute != nil {
+		fc.afterCompute(key, func() {
+			fc.onCompute(key, result, elapsed)
+		})
+	}
+
+	// The result depends on external state that changed during the computation
+	if fc.guard != nil && fc.guard() != token {
+		log.Printf("Compute guard changed, not caching: %v\n", key)
+		return result, nil
+	}
+
+	// Sentinels mean failure in functions which cannot return an error
+	if fc.sentinel != nil && fc.sentinel(result) {
+		log.Printf("Sentinel result, not caching: %v -> %v\n", key, result)
+		return result, nil
+	}
+
+	encoded, err := fc.encodeValue(result)
+	if err != nil {
+		log.Printf("Encoding failed, not caching: %v, %v\n", key, err)
+		return result, nil
+	}
+	// The limit applies to the codec output, not to a weak reference to it
+	if fc.maxValueBytes > 0 {
+		if size := fc.sizeFunc(encoded); size > fc.maxValueBytes {
+			fc.oversized.Add(1)
+			log.Printf("Value of %d bytes over the limit, not caching: %v\n", size, key)
+			return result, nil
+		}
+	}
+	stored := fc.hold(encoded)
+
+	fc.lock()
+	switch {
+	case fc.setSupersedes && fc.sources[key] == SourceSet && !fc.entry[key].Before(start):
+		log.Printf("Set during the computation takes precedence, not caching: %v\n", key)
+	case fc.admit(key):
+		fc.store(key, stored)
+	}
+	if fc.interval > 0 {
+		last, found := fc.last[key]
+		fc.last[key] = result
+		fc.lastTime[key] = time.Now()
+		if found {
+			fc.discard(key, last)
+		}
+	}
+	fc.unlock()
+	return result, nil
+}
+
+// afterCompute runs fn once the waiters of the computation of key have been woken up,
+// or right away if nothing is in flight for key.
+func (fc *FunctionCache) afterCompute(key string, fn func()) {
+	if fc.group.after(key, fn) || fc.group.after(bustPrefix+key, fn) {
+		return
+	}
+	fn()
+}
+
+// lookup returns the value stored under key. With lazy expiry, or for an entry with
+// its own TTL which may be shorter than the sweep interval, an expired entry is
+// removed and reported as missing unless it is served while revalidating, as is an
+// entry whose weak value was collected. It must be called with fc.m held.
+func (fc *FunctionCache) lookup(key string) (interface{}, bool) {
+	result, found := fc.cache[key]
+	if found && fc.checksOnRead(key) && fc.paused == 0 && fc.isExpired(key) && !fc.serveStale(key) {
+		fc.expire(key)
+		return nil, false
+	}
+	if found && fc.weakValues {
+		// A value collected by the GC is a miss, its entry is of no use anymore
+		if _, err := strengthen(result); err != nil {
+			log.Printf("Value was collected: %v\n", key)
+			fc.remove(key)
+			return nil, false
+		}
+	}
+	return result, found
+}
+
+// checksOnRead reports whether the expiry of key is checked when it is read rather
+// than left to the sweeps. It must be called with fc.m held.
+func (fc *FunctionCache) checksOnRead(key string) bool {
+	if fc.lazy {
+		return true
+	}
+	_, own := fc.ttls[key]
+	return own
+}
+
+// PauseExpiry suspends expiration until a matching ResumeExpiry, e.g. for a bulk
+// operation that must not see entries disappear. Entries past their TTL are served
+// meanwhile. Pauses nest: expiry resumes with the last ResumeExpiry.
+func (fc *FunctionCache) PauseExpiry() {
+	fc.lock()
+	defer fc.unlock()
+	fc.paused++
+}
+
+// ResumeExpiry ends a PauseExpiry. Ending the last pause removes the entries which
+// expired meanwhile right away.
+func (fc *FunctionCache) ResumeExpiry() {
+	fc.lock()
+	defer fc.unlock()
+	if fc.paused == 0 {
+		log.Printf("Warning: ResumeExpiry called without PauseExpiry\n")
+		return
+	}
+	fc.paused--
+	fc.sweep()
+}
+
+// PurgeExpired synchronously removes all expired entries, like ExpireNow, and returns
+// how many it removed, e.g. for maintenance endpoints. It returns 0 while expiry is
+// paused.
+func (fc *FunctionCache) PurgeExpired() int {
+	fc.lock()
+	defer fc.unlock()
+	return fc.sweep()
+}
+
+// ExpireNow synchronously runs one expiration sweep, which does nothing while expiry
+// is paused.
+func (fc *FunctionCache) ExpireNow() {
+	fc.lock()
+	defer fc.unlock()
+	fc.sweep()
+}
+
+// sweep removes all expired entries, unless expiry is paused, and returns how many it
+// removed. It must be called with fc.m held.
+func (fc *FunctionCache) sweep() int {
+	if fc.paused > 0 {
+		return 0
+	}
+	var purged int
+	if fc.expiryWorkers > 1 {
+		for _, k := range fc.expiredKeys() {
+			if !fc.serveStale(k) {
+				fc.expire(k)
+				purged++
+			}
+		}
+	} else {
+		fc.each(func(k string) {
+			if fc.isExpired(k) && !fc.serveStale(k) {
+				fc.expire(k)
+				purged++
 			}
+		})
+	}
+	if fc.weakValues {
+		fc.loosenOld()
+	}
+	for k, t := range fc.lastTime {
+		if time.Since(t) >= fc.interval {
+			last := fc.last[k]
+			delete(fc.last, k)
+			delete(fc.lastTime, k)
+			fc.discard(k, last)
+		}
+	}
+	for k, t := range fc.staleTime {
+		if time.Since(t) > fc.expiry() {
+			stale := fc.stale[k]
+			delete(fc.stale, k)
+			delete(fc.staleTime, k)
+			fc.discard(k, stale)
+		}
+	}
+	return purged
+}
 
-			// If the cache is still not available, return nil
-			log.Println("Cache not available after waiting, returning nil")
-			cached.m.Unlock()
-			return nil
-		}
-		cached.m.Unlock()
-
-		// Call the original function and cache the result
-		cached.m.Lock()
-		cached.inflight[key] = true
-		cached.mutex[key] = &sync.Mutex{}
-		cached.cond[key] = sync.NewCond(cached.mutex[key])
-		cached.m.Unlock()
-
-		// Call the original function
-		log.Printf("Calling original function: %v\n", key)
-		result := f(args...)
-		log.Printf("Original function result: %v -> %v\n", key, result)
-
-		cached.m.Lock()
-		cached.cache[key] = result
-		cached.entry[key] = time.Now()
-		cached.m.Unlock()
-
-		// Feature 2. In-Flight Request Deduplication - notify waiters
-		cached.m.Lock()
-		if _, found := cached.inflight[key]; found {
-			cached.cond[key].L.Lock()
-			log.Printf("Notifying waiters for slot: %v\n", key)
-			cached.cond[key].Broadcast()
-			cached.cond[key].L.Unlock()
-			delete(cached.inflight, key)
-		}
-		cached.m.Unlock()
-
-		// Return the result with time stamp of it
-		log.Printf("Returning result: %v -> %v\n", key, result)
-		return result
+// loosenOld leaves the values stored at least a sweep interval ago to the GC, so that
+// entries are held strongly for one to two sweep intervals. It must be called with
+// fc.m held.
+func (fc *FunctionCache) loosenOld() {
+	for key, value := range fc.cache {
+		if time.Since(fc.entry[key]) >= CacheExpirySleepTime {
+			fc.cache[key] = loosen(value)
+		}
+	}
+}
+
+// isExpired reports whether the entry stored under key outlived its expiry time.
+// It must be called with fc.m held.
+func (fc *FunctionCache) isExpired(key string) bool {
+	if fc.pinned[key] {
+		return false
+	}
+	return time.Since(fc.entry[key]) > fc.ttlOf(key)
+}
+
+// ttlOf returns the expiry time of the entry stored under key. It must be called with
+// fc.m held.
+func (fc *FunctionCache) ttlOf(key string) time.Duration {
+	if ttl, found := fc.ttls[key]; found {
+		return ttl
+	}
+	return fc.expiry()
+}
+
+// expire removes an expired entry, retaining its value for one more expiry time
+// when stale values are served on errors. It must be called with fc.m held.
+func (fc *FunctionCache) expire(key string) {
+	if fc.keepStale && len(fc.stale) < fc.capacity() {
+		fc.stale[key] = fc.cache[key]
+		fc.staleTime[key] = time.Now()
+	}
+	fc.removeAs(key, EventExpire)
+	fc.expired.Add(1)
+	fc.publish(EventExpire, key)
+}
+
+// staleOnError returns the retained stale value of key in place of err if there is one.
+func (fc *FunctionCache) staleOnError(key string, err error) (interface{}, error) {
+	fc.lock()
+	result, found := fc.stale[key]
+	fc.unlock()
+	if !found {
+		return nil, err
+	}
+	if result, decodeErr := fc.decode(result); decodeErr == nil {
+		log.Printf("Serving stale value on error: %v -> %v, %v\n", key, result, err)
+		return result, nil
+	}
+	return nil, err
+}
+
+// admit reports whether the result for key may be stored by the TinyLFU filter and
+// the admission threshold, consuming its request count once the threshold is
+// reached. It must be called with fc.m held.
+func (fc *FunctionCache) admit(key string) bool {
+	if fc.sketch != nil && !fc.frequent(key) {
+		return false
+	}
+	if fc.admission == 0 {
+		return true
+	}
+	if fc.seen[key] < fc.admission {
+		log.Printf("Not admitted: %v, seen: %d/%d\n", key, fc.seen[key], fc.admission)
+		// Forget all counts once they outgrow the cache to keep the tracking bounded
+		if len(fc.seen) > fc.capacity() {
+			fc.seen = make(map[string]int)
+		}
+		return false
 	}
+	delete(fc.seen, key)
+	return true
 }
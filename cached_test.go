@@ -2,9 +2,11 @@ package cached
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -299,3 +301,423 @@ func BenchmarkCachedFunctionExecutionHighParallelism(b *testing.B) {
 		}
 	})
 }
+
+// Test: Errors are returned but not cached
+func TestCachedFunctionWithError(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+
+	// Define a function failing on its first call
+	f := func(args ...interface{}) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("backend down")
+		}
+		return args[0], nil
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.WrapE(f)
+
+	if _, err := cachedFunc(1); err == nil {
+		t.Errorf("Expected first call to fail")
+	}
+	if result, err := cachedFunc(1); err != nil || result != 1 {
+		t.Errorf("Expected second call to recompute, got %v, %v", result, err)
+	}
+	cachedFunc(1)
+
+	if calls != 2 {
+		t.Errorf("Expected function to be called twice, but it was called %d times", calls)
+	}
+}
+
+// Test: The expiration goroutine stops on Close
+func TestFunctionCacheClose(t *testing.T) {
+	// mock cache
+	fc := NewFunctionCache(context.Background())
+
+	if !fc.Running() {
+		t.Errorf("Expected expiration goroutine to be running")
+	}
+
+	fc.Close()
+
+	if fc.Running() {
+		t.Errorf("Expected expiration goroutine to be stopped after Close")
+	}
+}
+
+// Test: Entries can be deleted one by one or all at once
+func TestFunctionCacheDeleteAndClear(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	cachedFunc(2)
+	cachedFunc(3)
+
+	fc.Delete(1)
+	if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{1})]; ok || len(fc.cache) != 2 {
+		t.Errorf("Expected only the deleted entry to be removed, got %v", fc.cache)
+	}
+
+	fc.Clear()
+	if len(fc.cache) != 0 {
+		t.Errorf("Expected cache to be empty after Clear, got %v", fc.cache)
+	}
+}
+
+// Test: ExpireNow removes expired entries without a background goroutine
+func TestCachedFunctionExpireNow(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithLazyExpiry(), WithTTL(20*time.Millisecond))
+
+	if fc.Running() {
+		t.Errorf("Expected no expiration goroutine with lazy expiry")
+	}
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+
+	time.Sleep(50 * time.Millisecond)
+	key := fmt.Sprintf("%v", []interface{}{1})
+	if _, ok := fc.cache[key]; !ok {
+		t.Errorf("Expected entry to stay until an expiration pass")
+	}
+
+	fc.ExpireNow()
+	if _, ok := fc.cache[key]; ok {
+		t.Errorf("Expected entry to be removed by ExpireNow")
+	}
+}
+
+// Test: PurgeExpired reports how many expired entries it removed
+func TestCachedFunctionPurgeExpired(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithLazyExpiry(), WithTTL(20*time.Millisecond))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 3; i++ {
+		cachedFunc(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cachedFunc("fresh")
+
+	if purged := fc.PurgeExpired(); purged != 3 {
+		t.Errorf("Expected 3 expired entries to be purged, got %d", purged)
+	}
+	if size := fc.Stats().Size; size != 1 {
+		t.Errorf("Expected the fresh entry to stay, got %d entries", size)
+	}
+	if purged := fc.PurgeExpired(); purged != 0 {
+		t.Errorf("Expected nothing left to purge, got %d", purged)
+	}
+}
+
+// Test: Reporting wrapper distinguishes the computing leader from hits and waiters
+func TestCachedFunctionReporting(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Define a slow function
+	f := func(args ...interface{}) interface{} {
+		time.Sleep(100 * time.Millisecond)
+		return args[0]
+	}
+
+	// Create a reporting cached version of the function
+	cachedFunc := fc.WrapReporting(f)
+
+	var wg sync.WaitGroup
+	reports := make([]bool, 5)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, reports[i] = cachedFunc(1)
+		}(i)
+	}
+	wg.Wait()
+
+	var leaders int
+	for _, hit := range reports {
+		if !hit {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("Expected exactly one leader to report a computation, got %d", leaders)
+	}
+
+	if _, hit := cachedFunc(1); !hit {
+		t.Errorf("Expected cache hit to be reported")
+	}
+}
+
+// Test: A bust call recomputes and stores the fresh result
+func TestCachedFunctionBust(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+
+	// Define a function returning a new value on every call
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return calls
+	}
+
+	// Create a cached and a busting version of the function
+	cachedFunc := fc.Wrap(f)
+	bustFunc := fc.WrapBust(f)
+
+	cachedFunc(1)
+	if result := bustFunc(1); result != 2 {
+		t.Errorf("Expected bust to recompute, got %v", result)
+	}
+	if result := cachedFunc(1); result != 2 {
+		t.Errorf("Expected fresh result to be stored, got %v", result)
+	}
+	if calls != 2 {
+		t.Errorf("Expected function to be called twice, but it was called %d times", calls)
+	}
+}
+
+// Test: Forgetting a slow key lets a new call start its own computation
+func TestCachedFunctionForget(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+	release := make(chan struct{})
+
+	// Define a function whose first call hangs until released
+	f := func(args ...interface{}) interface{} {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			return "old"
+		}
+		return "new"
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	var wg sync.WaitGroup
+	var leader, waiter interface{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		leader = cachedFunc(1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		waiter = cachedFunc(1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	fc.Forget(1)
+	if result := cachedFunc(1); result != "new" {
+		t.Errorf("Expected a new computation after Forget, got %v", result)
+	}
+
+	close(release)
+	wg.Wait()
+	if leader != "old" || waiter != "old" {
+		t.Errorf("Expected old leader and its waiter to get the old result, got %v and %v", leader, waiter)
+	}
+	if calls != 2 {
+		t.Errorf("Expected function to be called twice, but it was called %d times", calls)
+	}
+}
+
+// Test: Wrapping a nil function panics with a clear message before any call
+func TestCachedFunctionNilFunc(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	defer func() {
+		r := recover()
+		if r != "cached: Wrap called with a nil function" {
+			t.Errorf("Expected a clear panic on a nil function, got %v", r)
+		}
+		if len(fc.group.calls) != 0 {
+			t.Errorf("Expected no in-flight state, got %v", fc.group.calls)
+		}
+	}()
+	fc.Wrap(nil)
+	t.Errorf("Expected Wrap to panic")
+}
+
+// Test: Only the first of the functions supplied for the same key runs
+func TestGetOrCompute(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result := fc.GetOrCompute(func() interface{} {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return i
+			}, "key")
+			if result != fc.GetOrCompute(func() interface{} { return -1 }, "key") {
+				t.Errorf("Expected all callers to get the same value, got %v", result)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected only one function to run, but %d did", calls)
+	}
+}
+
+// Test: Expiration sweeps run on the ticks of the ticker
+func TestCachedFunctionExpiryTicker(t *testing.T) {
+	// mock clock
+	ticks := make(chan time.Time)
+	var stopped atomic.Bool
+	defer func(f func(time.Duration) (<-chan time.Time, func())) { newTicker = f }(newTicker)
+	newTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() { stopped.Store(true) }
+	}
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(10*time.Millisecond))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	time.Sleep(20 * time.Millisecond)
+
+	// Nothing is swept between ticks
+	if size := fc.Stats().Size; size != 1 {
+		t.Errorf("Expected the entry to be kept until the next tick, got %d entries", size)
+	}
+
+	// The second tick is only received once the sweep of the first one is done
+	ticks <- time.Now()
+	ticks <- time.Now()
+	if stats := fc.Stats(); stats.Size != 0 || stats.Expirations != 1 {
+		t.Errorf("Expected the entry to be swept on the tick, got %+v", stats)
+	}
+
+	fc.Close()
+	if !stopped.Load() {
+		t.Errorf("Expected the ticker to be stopped on Close")
+	}
+}
+
+// Test: Entries past their TTL are served while expiry is paused and expire on resume
+func TestCachedFunctionPauseExpiry(t *testing.T) {
+	// mock clock
+	ticks := make(chan time.Time)
+	defer func(f func(time.Duration) (<-chan time.Time, func())) { newTicker = f }(newTicker)
+	newTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(10*time.Millisecond))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	})
+	cachedFunc(1)
+
+	// Nested pauses hold off the background sweeps
+	fc.PauseExpiry()
+	fc.PauseExpiry()
+	time.Sleep(20 * time.Millisecond)
+	ticks <- time.Now()
+	ticks <- time.Now()
+	fc.ResumeExpiry()
+	fc.ExpireNow()
+	if cachedFunc(1); calls != 1 {
+		t.Errorf("Expected the expired entry to be served while paused, function was called %d times", calls)
+	}
+
+	fc.ResumeExpiry()
+	if stats := fc.Stats(); stats.Size != 0 || stats.Expirations != 1 {
+		t.Errorf("Expected the entry to expire on resume, got %+v", stats)
+	}
+}
+
+// Test: The same entry is served to a lenient caller but recomputed for a strict one
+func TestGetFresherThan(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+	version := func() interface{} {
+		time.Sleep(20 * time.Millisecond)
+		return int(atomic.AddInt32(&calls, 1))
+	}
+
+	fc.GetFresherThan(time.Hour, version, "key")
+	time.Sleep(30 * time.Millisecond)
+	if result := fc.GetFresherThan(time.Hour, version, "key"); result != 1 {
+		t.Errorf("Expected the lenient caller to get the cached 1, got %v", result)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := fc.GetFresherThan(10*time.Millisecond, version, "key"); result != 2 {
+				t.Errorf("Expected strict callers to share the recomputed 2, got %v", result)
+			}
+		}()
+	}
+	wg.Wait()
+	if result := fc.GetOrCompute(version, "key"); result != 2 || calls != 2 {
+		t.Errorf("Expected the recomputed value to replace the entry, got %v after %d calls", result, calls)
+	}
+}
@@ -0,0 +1,97 @@
+package cached
+
+import (
+	"io"
+	"log"
+	"reflect"
+)
+
+// removed is a value removed from the cache waiting to be released outside the lock.
+type removed struct {
+	key   string
+	value interface{}
+}
+
+// unlock releases the cache lock and then delivers the audit events and releases the
+// values removed while it was held, so that audit sinks, OnEvict hooks and Close
+// methods never run under the lock.
+func (fc *FunctionCache) unlock() {
+	pending := fc.pending
+	fc.pending = nil
+	if audits := fc.audits; audits != nil {
+		fc.audits = nil
+		// Taking the audit lock before releasing fc.m keeps deliveries in order
+		fc.auditM.Lock()
+		fc.m.Unlock()
+		for _, e := range audits {
+			fc.audit(e)
+		}
+		fc.auditM.Unlock()
+	} else {
+		fc.m.Unlock()
+	}
+	for _, r := range pending {
+		fc.release(r)
+	}
+}
+
+// discard queues value, removed from one of the maps holding key, to be released
+// unless the cache still holds it elsewhere. It must be called with fc.m held.
+func (fc *FunctionCache) discard(key string, value interface{}) {
+	if fc.onEvict == nil && fc.decoder == nil {
+		// Encoded values are only decoded outside the lock, in release
+		held, _ := strengthen(value)
+		if _, ok := held.(io.Closer); !ok {
+			return
+		}
+	}
+	// Weak values are compared by reference, whether still held strongly or not
+	ref := loosen(value)
+	if same(loosen(fc.cache[key]), ref) || same(loosen(fc.stale[key]), ref) || same(loosen(fc.last[key]), ref) {
+		return
+	}
+	fc.pending = append(fc.pending, removed{key: key, value: value})
+}
+
+// release runs the OnEvict hook and closes io.Closer values with the value as the
+// function returned it, decoded and, when weakly held, unless it was collected. Closing is delayed until an in-flight computation of the key
+// has finished, so that a value is never closed before the waiters of that
+// computation received it.
+func (fc *FunctionCache) release(r removed) {
+	value, err := fc.decode(r.value)
+	if err != nil {
+		// Collected values are gone already, there is nothing left to release
+		if err != errCollected {
+			log.Printf("Decoding removed value failed, not releasing: %v, %v\n", r.key, err)
+		}
+		return
+	}
+	r.value = value
+	if fc.onEvict != nil {
+		fc.onEvict(r.key, r.value)
+	}
+	closer, ok := r.value.(io.Closer)
+	if !ok {
+		return
+	}
+	closeValue := func() {
+		if err := closer.Close(); err != nil {
+			log.Printf("Closing removed value failed: %v, %v\n", r.key, err)
+		}
+	}
+	if !fc.group.after(r.key, closeValue) {
+		closeValue()
+	}
+}
+
+// same reports whether a and b are the same comparable value.
+func same(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
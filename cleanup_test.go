@@ -0,0 +1,168 @@
+package cached
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resource is a cached value holding something that must be closed
+type resource struct {
+	closed int32
+}
+
+func (r *resource) Close() error {
+	atomic.AddInt32(&r.closed, 1)
+	return nil
+}
+
+// Test: Closers are closed exactly once when they leave the cache
+func TestCachedFunctionCloseOnEvict(t *testing.T) {
+	var evicted []string
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(1), WithOnEvict(func(key string, value interface{}) {
+		evicted = append(evicted, key)
+	}))
+
+	// Define a function opening resources
+	f := func(args ...interface{}) interface{} {
+		return &resource{}
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	first := cachedFunc(1).(*resource)
+	second := cachedFunc(2).(*resource)
+	cachedFunc(2)
+
+	if n := atomic.LoadInt32(&first.closed); n != 1 {
+		t.Errorf("Expected evicted resource to be closed once, got %d", n)
+	}
+	if n := atomic.LoadInt32(&second.closed); n != 0 {
+		t.Errorf("Expected cached resource to stay open, got %d closes", n)
+	}
+
+	fc.Clear()
+	if n := atomic.LoadInt32(&second.closed); n != 1 {
+		t.Errorf("Expected cleared resource to be closed once, got %d", n)
+	}
+	if len(evicted) != 2 {
+		t.Errorf("Expected OnEvict to be called twice, got %v", evicted)
+	}
+}
+
+// Test: Values replaced by Set and CompareAndSwap are released, by Swap handed back
+func TestCachedFunctionCloseOnReplace(t *testing.T) {
+	var evicted int32
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithOnEvict(func(key string, value interface{}) {
+		atomic.AddInt32(&evicted, 1)
+	}))
+
+	first, second, third, fourth := &resource{}, &resource{}, &resource{}, &resource{}
+	fc.Set(first, "k")
+	fc.Set(second, "k")
+	if n := atomic.LoadInt32(&first.closed); n != 1 {
+		t.Errorf("Expected the value replaced by Set to be closed once, got %d", n)
+	}
+	if !fc.CompareAndSwap(second, third, "k") {
+		t.Fatalf("Expected CompareAndSwap to succeed")
+	}
+	if n := atomic.LoadInt32(&second.closed); n != 1 {
+		t.Errorf("Expected the value replaced by CompareAndSwap to be closed once, got %d", n)
+	}
+	if old, _ := fc.Swap(fourth, "k"); old != third || atomic.LoadInt32(&third.closed) != 0 {
+		t.Errorf("Expected Swap to hand back the open value, got %v", old)
+	}
+	if n := atomic.LoadInt32(&evicted); n != 2 {
+		t.Errorf("Expected OnEvict for the released values only, got %d calls", n)
+	}
+}
+
+// Test: Hooks and Close get values decoded from the stored form of a codec
+func TestCachedFunctionOnEvictDecoded(t *testing.T) {
+	var evicted []interface{}
+	encode, decode := NewGzipCodec(1)
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithValueCodec(encode, decode), WithOnEvict(func(key string, value interface{}) {
+		evicted = append(evicted, value)
+	}))
+	fc.Set([]byte("payload"), "k")
+	fc.Delete("k")
+	if len(evicted) != 1 || string(evicted[0].([]byte)) != "payload" {
+		t.Errorf("Expected OnEvict to get the decoded value, got %#v", evicted)
+	}
+
+	// A codec wrapping closers still gets them closed
+	type wrapped struct{ r *resource }
+	r := &resource{}
+	boxed := NewFunctionCache(ctx, WithValueCodec(func(v interface{}) (interface{}, error) {
+		return wrapped{v.(*resource)}, nil
+	}, func(v interface{}) (interface{}, error) {
+		return v.(wrapped).r, nil
+	}))
+	boxed.Set(r, "k")
+	boxed.Delete("k")
+	if n := atomic.LoadInt32(&r.closed); n != 1 {
+		t.Errorf("Expected the decoded closer to be closed once, got %d", n)
+	}
+}
+
+// Test: An OnEvict hook can write to the same cache from every removal path
+func TestCachedFunctionReentrantOnEvict(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fc *FunctionCache
+	var hooked int32
+	fc = NewFunctionCache(ctx, WithMaxSize(4), WithTTL(time.Hour), WithOnEvict(func(key string, value interface{}) {
+		atomic.AddInt32(&hooked, 1)
+		if !strings.Contains(key, "gone") {
+			fc.Set(value, "gone", key)
+		}
+	}))
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Eviction, Delete, expiry and Clear all call the hook
+		for i := 0; i < 6; i++ {
+			cachedFunc(i)
+		}
+		fc.Delete(5)
+		cachedFunc("expiring")
+		fc.SetTTL(time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		fc.ExpireNow()
+		fc.SetTTL(time.Hour)
+		cachedFunc("cleared")
+		fc.Clear()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected hooks calling back into the cache not to deadlock")
+	}
+
+	if atomic.LoadInt32(&hooked) == 0 {
+		t.Fatalf("Expected the hook to be called")
+	}
+	if _, found := fc.EntryInfo("gone", DefaultKey("cleared")); !found {
+		t.Errorf("Expected the hook to record the cleared entry")
+	}
+}
@@ -0,0 +1,123 @@
+package cached
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// errCollected is returned when decoding a weakly held value reclaimed by the GC.
+var errCollected = errors.New("cached: value was garbage collected")
+
+// encode converts a value into its stored form using the configured codec and, with
+// weak values, a weak reference to the result.
+func (fc *FunctionCache) encode(value interface{}) (interface{}, error) {
+	value, err := fc.encodeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return fc.hold(value), nil
+}
+
+// encodeValue converts a value with the configured codec only.
+func (fc *FunctionCache) encodeValue(value interface{}) (interface{}, error) {
+	if fc.encoder == nil {
+		return value, nil
+	}
+	return fc.encoder(value)
+}
+
+// hold returns the reference the cache keeps to an encoded value, a weak one with
+// weak values.
+func (fc *FunctionCache) hold(value interface{}) interface{} {
+	if fc.weakValues {
+		return weaken(value)
+	}
+	return value
+}
+
+// decode converts a stored value back using the configured codec.
+func (fc *FunctionCache) decode(value interface{}) (interface{}, error) {
+	if fc.weakValues {
+		var err error
+		if value, err = strengthen(value); err != nil {
+			return nil, err
+		}
+	}
+	if fc.decoder == nil {
+		return value, nil
+	}
+	return fc.decoder(value)
+}
+
+// sizeOf returns the size of a stored value, measuring a weakly held value itself
+// rather than its reference. Collected values have no size.
+func (fc *FunctionCache) sizeOf(stored interface{}) int {
+	if fc.weakValues {
+		value, err := strengthen(stored)
+		if err != nil {
+			return 0
+		}
+		stored = value
+	}
+	return fc.sizeFunc(stored)
+}
+
+// DefaultSize estimates the size in bytes of a stored value: the length of strings
+// and byte slices, and the in-memory size of the value itself for other types.
+func DefaultSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case gzipped:
+		return len(v)
+	}
+	return int(reflect.TypeOf(value).Size())
+}
+
+// gzipped is a byte slice compressed by the gzip codec.
+type gzipped []byte
+
+// Snapshots hold values in their stored form, which users cannot register for gzipped
+func init() {
+	gob.Register(gzipped(nil))
+}
+
+// NewGzipCodec returns an encode and decode pair for WithValueCodec that gzips
+// []byte values of at least threshold bytes and leaves all other values unchanged.
+func NewGzipCodec(threshold int) (encode, decode func(interface{}) (interface{}, error)) {
+	encode = func(value interface{}) (interface{}, error) {
+		data, ok := value.([]byte)
+		if !ok || len(data) < threshold {
+			return value, nil
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return gzipped(buf.Bytes()), nil
+	}
+	decode = func(value interface{}) (interface{}, error) {
+		data, ok := value.(gzipped)
+		if !ok {
+			return value, nil
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	}
+	return encode, decode
+}
@@ -0,0 +1,39 @@
+package cached
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Test: Large values round-trip through the gzip codec and are accounted compressed
+func TestCachedFunctionValueCodec(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithValueCodec(NewGzipCodec(1024)))
+
+	blob := bytes.Repeat([]byte(`{"name":"value","count":42},`), 4096)
+
+	// Define a function returning a large value
+	f := func(args ...interface{}) interface{} {
+		return blob
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	cachedFunc(1)
+	result, hit := fc.WrapReporting(f)(1)
+	if !hit {
+		t.Errorf("Expected value to be served from the cache")
+	}
+	if !bytes.Equal(result.([]byte), blob) {
+		t.Errorf("Expected decoded value to equal the original")
+	}
+
+	stats := fc.Stats()
+	if stats.Bytes == 0 || stats.Bytes >= int64(len(blob)) {
+		t.Errorf("Expected compressed size below %d bytes, got %d", len(blob), stats.Bytes)
+	}
+}
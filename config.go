@@ -0,0 +1,69 @@
+package cached
+
+import "time"
+
+// Config is a read-only copy of the effective settings of a FunctionCache.
+type Config struct {
+	MaxSize            int
+	TTL                time.Duration
+	SweepInterval      time.Duration
+	Policy             EvictionPolicy
+	AdmissionThreshold int
+}
+
+// Config returns the settings currently in effect, including changes made by the setters.
+func (fc *FunctionCache) Config() Config {
+	fc.lock()
+	defer fc.unlock()
+	return Config{
+		MaxSize:            fc.capacity(),
+		TTL:                fc.expiry(),
+		SweepInterval:      CacheExpirySleepTime,
+		Policy:             fc.policy,
+		AdmissionThreshold: fc.admission,
+	}
+}
+
+// SetMaxSize changes the maximum number of entries, evicting entries right away
+// when the cache is shrunk below its current size.
+func (fc *FunctionCache) SetMaxSize(n int) {
+	fc.lock()
+	defer fc.unlock()
+	fc.maxSize = n
+	if fc.partition != nil {
+		for part, size := range fc.partSizes {
+			if size > fc.capacity() {
+				fc.evict(size-fc.capacity(), part)
+			}
+		}
+		return
+	}
+	if size := fc.size(""); size > fc.capacity() {
+		fc.evict(size-fc.capacity(), "")
+	}
+}
+
+// SetTTL changes the time after which entries expire.
+func (fc *FunctionCache) SetTTL(d time.Duration) {
+	fc.lock()
+	defer fc.unlock()
+	fc.ttl = d
+}
+
+// capacity returns the maximum number of entries, falling back to MaxCacheSize.
+// It must be called with fc.m held.
+func (fc *FunctionCache) capacity() int {
+	if fc.maxSize > 0 {
+		return fc.maxSize
+	}
+	return MaxCacheSize
+}
+
+// expiry returns the entry expiry time, falling back to CacheExpiryTime.
+// It must be called with fc.m held.
+func (fc *FunctionCache) expiry() time.Duration {
+	if fc.ttl > 0 {
+		return fc.ttl
+	}
+	return CacheExpiryTime
+}
@@ -0,0 +1,38 @@
+package cached
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: Config reflects constructor options and later changes
+func TestFunctionCacheConfig(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(10), WithTTL(time.Second), WithEvictionPolicy(LRU))
+
+	cfg := fc.Config()
+	if cfg.MaxSize != 10 || cfg.TTL != time.Second || cfg.Policy != LRU {
+		t.Errorf("Expected config to reflect options, got %+v", cfg)
+	}
+
+	// Fill the cache and shrink it afterwards
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 10; i++ {
+		cachedFunc(i)
+	}
+	fc.SetMaxSize(5)
+	fc.SetTTL(time.Minute)
+
+	cfg = fc.Config()
+	if cfg.MaxSize != 5 || cfg.TTL != time.Minute {
+		t.Errorf("Expected config to reflect setters, got %+v", cfg)
+	}
+	if len(fc.cache) != 5 {
+		t.Errorf("Expected cache to be shrunk to 5 entries, got %d", len(fc.cache))
+	}
+}
@@ -0,0 +1,70 @@
+package cached
+
+import (
+	"context"
+	"log"
+)
+
+// contextKey is the type of the context keys of this package.
+type contextKey string
+
+// NoCacheKey is the context key which, set to true, makes calls through WrapContext
+// bypass the cache, e.g. for requests carrying a debug header. Use NoCache to set it.
+const NoCacheKey contextKey = "cached-no-cache"
+
+// NoCache returns a copy of ctx in which calls through WrapContext bypass the cache.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, NoCacheKey, true)
+}
+
+// WrapContext creates a cached version of a function taking a context. The context
+// is not part of the key. Calls with a context marked by NoCache compute a fresh
+// result which is neither served from nor stored in the cache. Computations running
+// in the background, e.g. refreshes of stale entries, get a context with the values
+// of ctx which is cancelled when the cache is closed instead of when ctx is done.
+func (fc *FunctionCache) WrapContext(f func(ctx context.Context, args ...interface{}) interface{}) func(ctx context.Context, args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: WrapContext called with a nil function")
+	}
+	return func(ctx context.Context, args ...interface{}) interface{} {
+		args = fc.transformed(args)
+		if bypass, _ := ctx.Value(NoCacheKey).(bool); bypass {
+			log.Printf("Bypassing cache for no-cache context: %v\n", args)
+			return f(ctx, args...)
+		}
+		return fc.callContext(ctx, f, args)
+	}
+}
+
+// detached is a context carrying the values of a caller's context with the lifetime
+// of the cache, for computations outliving their caller.
+type detached struct {
+	context.Context
+	values context.Context
+}
+
+// Value returns the value of key in the caller's context.
+func (d detached) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
+
+// detach binds computeCtx to a context with the values of ctx which is cancelled when
+// the cache is closed or after the compute timeout, if set, instead of when the
+// caller is done. Results computed once the context is cancelled fail with its error,
+// so that they are not stored. The returned function releases the context.
+func (fc *FunctionCache) detach(ctx context.Context, computeCtx func(ctx context.Context) (interface{}, error)) (func() (interface{}, error), context.CancelFunc) {
+	var cancel context.CancelFunc
+	ctx = detached{Context: fc.ctx, values: ctx}
+	if fc.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, fc.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return func() (interface{}, error) {
+		result, err := computeCtx(ctx)
+		if err == nil {
+			err = ctx.Err()
+		}
+		return result, err
+	}, cancel
+}
@@ -0,0 +1,89 @@
+package cached
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: A no-cache context recomputes while a normal context hits the cache
+func TestCachedFunctionWrapContextNoCache(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	cachedFunc := fc.WrapContext(func(ctx context.Context, args ...interface{}) interface{} {
+		calls++
+		return calls
+	})
+
+	if result := cachedFunc(ctx, "id"); result != 1 {
+		t.Errorf("Expected the first computation, got %v", result)
+	}
+	if result := cachedFunc(NoCache(ctx), "id"); result != 2 {
+		t.Errorf("Expected a fresh computation for the no-cache context, got %v", result)
+	}
+	if result := cachedFunc(ctx, "id"); result != 1 {
+		t.Errorf("Expected the normal context to hit the cached value, got %v", result)
+	}
+	if calls != 2 {
+		t.Errorf("Expected function to be called twice, but it was called %d times", calls)
+	}
+}
+
+// Test: Background computations outlive their caller but are cancelled by Close
+func TestWrapContextBackgroundCancelledOnClose(t *testing.T) {
+	// mock cache
+	fc := NewFunctionCache(context.Background(), WithFirstMissFallback(func(args ...interface{}) interface{} {
+		return "fallback"
+	}))
+
+	type userKey struct{}
+	started := make(chan interface{}, 1)
+	cancelled := make(chan error, 1)
+	cachedFunc := fc.WrapContext(func(ctx context.Context, args ...interface{}) interface{} {
+		started <- ctx.Value(userKey{})
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return "late"
+	})
+
+	// The caller is done long before the background computation
+	reqCtx, reqCancel := context.WithCancel(context.WithValue(context.Background(), userKey{}, "alice"))
+	if result := cachedFunc(reqCtx, "id"); result != "fallback" {
+		t.Errorf("Expected the fallback, got %v", result)
+	}
+	reqCancel()
+	if user := <-started; user != "alice" {
+		t.Errorf("Expected the values of the caller's context, got %v", user)
+	}
+	select {
+	case <-cancelled:
+		t.Fatalf("Expected the background computation to outlive its caller")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	fc.Close()
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Errorf("Expected the background computation to be cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Close to cancel the background computation")
+	}
+	// Wait for the background computation to finish, so it does not outlive the test
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if keys, _ := fc.InFlight(); keys == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the background computation to finish after Close")
+		}
+	}
+	if _, found := fc.EntryInfo("id"); found {
+		t.Errorf("Expected the result of the cancelled computation not to be stored")
+	}
+}
@@ -0,0 +1,111 @@
+package cached
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockTimeout is how long an internal lock acquisition may block in DEBUG mode
+// before a stack dump of all goroutines is logged
+var LockTimeout = 5 * time.Second
+
+// lock acquires the cache lock.
+func (fc *FunctionCache) lock() {
+	lock(&fc.m)
+}
+
+// lock acquires m. In DEBUG mode it polls the lock and logs a stack dump when it
+// cannot be acquired within LockTimeout, then keeps waiting. Otherwise it is a plain Lock.
+func lock(m *sync.Mutex) {
+	if !debug.Load() {
+		m.Lock()
+		return
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	for !m.TryLock() {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			log.Printf("Lock not acquired within %v, possible deadlock:\n%s\n", LockTimeout, buf[:n])
+			m.Lock()
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// stack returns the stack trace of the current goroutine.
+func stack() []byte {
+	buf := make([]byte, 64<<10)
+	return buf[:runtime.Stack(buf, false)]
+}
+
+// Leaders returns the stack traces of the goroutines computing the keys in flight,
+// by key, to find out where hung computations are stuck. Stacks are only recorded
+// in DEBUG mode, otherwise no keys are returned.
+func (g *Group) Leaders() map[string]string {
+	lock(&g.m)
+	defer g.m.Unlock()
+	leaders := make(map[string]string)
+	for key, c := range g.calls {
+		if c.stack != nil {
+			leaders[key] = string(c.stack)
+		}
+	}
+	return leaders
+}
+
+// Leaders returns the stack traces of the goroutines computing the keys in flight
+// in this cache, see Group.Leaders.
+func (fc *FunctionCache) Leaders() map[string]string {
+	return fc.group.Leaders()
+}
+
+// inFlight returns the keys being computed.
+func (g *Group) inFlight() map[string]bool {
+	lock(&g.m)
+	defer g.m.Unlock()
+	keys := make(map[string]bool, len(g.calls))
+	for key := range g.calls {
+		keys[key] = true
+	}
+	return keys
+}
+
+// DebugDump logs every entry with its age, access count and whether it is being
+// recomputed, followed by the keys computed without an entry yet. It only holds the
+// cache lock while collecting the lines and does nothing outside of DEBUG mode.
+func (fc *FunctionCache) DebugDump() {
+	if !debug.Load() {
+		return
+	}
+	flying := fc.group.inFlight()
+	now := time.Now()
+
+	fc.lock()
+	lines := make([]string, 0, len(fc.cache)+len(flying))
+	fc.each(func(key string) {
+		lines = append(lines, fmt.Sprintf("%v: age %v, uses %d, in flight %v", key, now.Sub(fc.entry[key]), fc.uses[key], flying[key]))
+		delete(flying, key)
+	})
+	entries := len(lines)
+	fc.unlock()
+	pending := make([]string, 0, len(flying))
+	for key := range flying {
+		pending = append(pending, key)
+	}
+	sort.Strings(pending)
+	for _, key := range pending {
+		lines = append(lines, fmt.Sprintf("%v: in flight, no entry", key))
+	}
+
+	log.Printf("Cache dump, %d entries, %d in flight without one:\n", entries, len(pending))
+	for _, line := range lines {
+		log.Println(line)
+	}
+}
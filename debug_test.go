@@ -0,0 +1,162 @@
+package cached
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use as a log output
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+// captureLog enables DEBUG mode and redirects the log output until the returned function is called
+func captureLog() (*syncBuffer, func()) {
+	var out syncBuffer
+	prev := debug.Swap(true)
+	log.SetOutput(&out)
+	return &out, func() {
+		debug.Store(prev)
+		if prev {
+			log.SetOutput(os.Stderr)
+		} else {
+			log.SetOutput(io.Discard)
+		}
+	}
+}
+
+// Test: A lock held for too long produces a diagnostic in DEBUG mode
+func TestLockTimeoutDiagnostic(t *testing.T) {
+	out, restore := captureLog()
+	defer restore()
+	// mock timeout
+	defer func(d time.Duration) { LockTimeout = d }(LockTimeout)
+	LockTimeout = 50 * time.Millisecond
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Hold the lock while another goroutine tries to acquire it
+	fc.lock()
+	done := make(chan struct{})
+	go func() {
+		fc.lock()
+		fc.m.Unlock()
+		close(done)
+	}()
+
+	time.Sleep(4 * LockTimeout)
+	fc.m.Unlock()
+	<-done
+
+	if !strings.Contains(out.String(), "possible deadlock") {
+		t.Errorf("Expected lock diagnostic to be logged, got: %q", out.String())
+	}
+}
+
+// Test: The stack of the leader of an in-flight computation is recorded in DEBUG mode
+func TestLeadersDebug(t *testing.T) {
+	_, restore := captureLog()
+	defer restore()
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		close(started)
+		<-release
+		return args[0]
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cachedFunc("hung")
+	}()
+	<-started
+
+	leaders := fc.Leaders()
+	stack, found := leaders["[hung]"]
+	if !found || !strings.Contains(stack, "TestLeadersDebug") {
+		t.Errorf("Expected the leader stack to be recorded, got %v", leaders)
+	}
+
+	close(release)
+	<-done
+	if leaders := fc.Leaders(); len(leaders) != 0 {
+		t.Errorf("Expected no leaders once done, got %v", leaders)
+	}
+}
+
+// Test: DebugDump logs every key with its state in DEBUG mode only
+func TestDebugDump(t *testing.T) {
+	out, restore := captureLog()
+	defer restore()
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		if args[0] == "slow" {
+			close(started)
+			<-release
+		}
+		return args[0]
+	})
+	cachedFunc("a")
+	cachedFunc("a")
+	cachedFunc("b")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cachedFunc("slow")
+	}()
+	<-started
+
+	fc.DebugDump()
+	dump := out.String()
+	for _, want := range []string{"2 entries, 1 in flight", "[a]: age", "uses 1", "[b]: age", "[slow]: in flight, no entry"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected the dump to contain %q, got: %q", want, dump)
+		}
+	}
+	close(release)
+	<-done
+
+	// Outside of DEBUG mode nothing is logged
+	debug.Store(false)
+	before := out.String()
+	fc.DebugDump()
+	if out.String() != before {
+		t.Errorf("Expected no dump outside of DEBUG mode, got: %q", out.String()[len(before):])
+	}
+}
@@ -0,0 +1,61 @@
+package cached
+
+import "errors"
+
+// ErrDependencyCycle is returned by AddDependency for a dependency closing a cycle.
+var ErrDependencyCycle = errors.New("cached: dependency cycle")
+
+// AddDependency declares that the entry for childArgs is derived from the entry for
+// parentArgs, so that removing the parent by Delete, CompareAndDelete, an
+// invalidation event or storing a recomputed value also removes the child and, in
+// turn, its own dependents. Eviction and expiry of a parent do not cascade. The
+// dependency is kept until the parent is removed, and applies to entries stored for
+// the arguments later on too. Dependencies closing a cycle are rejected with
+// ErrDependencyCycle.
+func (fc *FunctionCache) AddDependency(childArgs, parentArgs []interface{}) error {
+	child, err := fc.key(fc.transformed(childArgs))
+	if err != nil {
+		return err
+	}
+	parent, err := fc.key(fc.transformed(parentArgs))
+	if err != nil {
+		return err
+	}
+
+	fc.lock()
+	defer fc.unlock()
+	if parent == child || fc.dependsOn(parent, child) {
+		return ErrDependencyCycle
+	}
+	for _, c := range fc.deps[parent] {
+		if c == child {
+			return nil
+		}
+	}
+	fc.deps[parent] = append(fc.deps[parent], child)
+	return nil
+}
+
+// dependsOn reports whether key is a direct or indirect dependent of parent. It must
+// be called with fc.m held.
+func (fc *FunctionCache) dependsOn(key, parent string) bool {
+	for _, child := range fc.deps[parent] {
+		if child == key || fc.dependsOn(key, child) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDependents removes the dependents of key and forgets their dependency. It
+// must be called with fc.m held.
+func (fc *FunctionCache) removeDependents(key string) {
+	children := fc.deps[key]
+	if children == nil {
+		return
+	}
+	delete(fc.deps, key)
+	for _, child := range children {
+		fc.remove(child)
+	}
+}
@@ -0,0 +1,70 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Test: Deleting a parent removes its whole subtree of dependents
+func TestFunctionCacheDependencies(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for _, arg := range []string{"base", "derived", "report", "summary", "other"} {
+		cachedFunc(arg)
+	}
+
+	// base <- derived <- report, base <- summary
+	deps := [][2]string{{"derived", "base"}, {"report", "derived"}, {"summary", "base"}}
+	for _, d := range deps {
+		if err := fc.AddDependency([]interface{}{d[0]}, []interface{}{d[1]}); err != nil {
+			t.Fatalf("Unexpected error adding %v: %v", d, err)
+		}
+	}
+	if err := fc.AddDependency([]interface{}{"base"}, []interface{}{"report"}); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("Expected a cycle to be rejected, got %v", err)
+	}
+
+	// Removing a leaf leaves its parents
+	fc.Delete("summary")
+	if _, found := fc.EntryInfo("base"); !found {
+		t.Errorf("Expected the parent of a deleted child to stay")
+	}
+
+	fc.Delete("base")
+	for _, arg := range []string{"base", "derived", "report"} {
+		if _, found := fc.EntryInfo(arg); found {
+			t.Errorf("Expected %v to be removed with its parent", arg)
+		}
+	}
+	if _, found := fc.EntryInfo("other"); !found {
+		t.Errorf("Expected unrelated entries to stay")
+	}
+}
+
+// Test: Clear removes every entry even when removals cascade to later entries
+func TestFunctionCacheClearDependencies(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for _, arg := range []string{"parent", "child", "a", "b"} {
+		cachedFunc(arg)
+	}
+	if err := fc.AddDependency([]interface{}{"child"}, []interface{}{"parent"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fc.Clear()
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected Clear to remove all entries, got %d left", size)
+	}
+}
@@ -0,0 +1,80 @@
+package cached
+
+// EventType is the kind of a cache event.
+type EventType int
+
+const (
+	// EventHit is a lookup served from the cache
+	EventHit EventType = iota
+	// EventMiss is a lookup not found in the cache
+	EventMiss
+	// EventEvict is an entry removed to make room
+	EventEvict
+	// EventExpire is an entry removed after its expiry time
+	EventExpire
+	// EventAdd is an entry stored, only delivered to audit sinks
+	EventAdd
+	// EventDelete is an entry removed for any other reason, e.g. Delete, Clear or being
+	// replaced, only delivered to audit sinks
+	EventDelete
+)
+
+// subscriberBuffer is the channel capacity of each subscriber
+const subscriberBuffer = 128
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventHit:
+		return "hit"
+	case EventMiss:
+		return "miss"
+	case EventEvict:
+		return "evict"
+	case EventExpire:
+		return "expire"
+	case EventAdd:
+		return "add"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event describes something that happened to a cache key.
+type Event struct {
+	Type EventType
+	Key  string
+}
+
+// Subscribe returns a channel receiving cache events and a function that unsubscribes
+// and closes the channel. Events are sent without blocking: when the consumer falls
+// behind they are dropped and counted in Stats.Drops.
+func (fc *FunctionCache) Subscribe() (<-chan Event, func()) {
+	fc.lock()
+	defer fc.unlock()
+	id := fc.nextSub
+	fc.nextSub++
+	ch := make(chan Event, subscriberBuffer)
+	fc.subs[id] = ch
+
+	return ch, func() {
+		fc.lock()
+		defer fc.unlock()
+		if _, found := fc.subs[id]; found {
+			delete(fc.subs, id)
+			close(ch)
+		}
+	}
+}
+
+// publish sends an event to all subscribers. It must be called with fc.m held.
+func (fc *FunctionCache) publish(t EventType, key string) {
+	for _, ch := range fc.subs {
+		select {
+		case ch <- Event{Type: t, Key: key}:
+		default:
+			fc.drops.Add(1)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package cached
+
+import (
+	"context"
+	"testing"
+)
+
+// Test: Subscribers receive events until they unsubscribe
+func TestFunctionCacheSubscribe(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(1))
+
+	events, unsubscribe := fc.Subscribe()
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	cachedFunc(1)
+	cachedFunc(2)
+
+	expected := []EventType{EventMiss, EventHit, EventMiss, EventEvict}
+	for _, typ := range expected {
+		if event := <-events; event.Type != typ {
+			t.Errorf("Expected %v event, got %v", typ, event.Type)
+		}
+	}
+
+	unsubscribe()
+	cachedFunc(3)
+	if event, ok := <-events; ok {
+		t.Errorf("Expected channel to be closed after unsubscribe, got %v", event)
+	}
+}
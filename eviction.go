@@ -0,0 +1,249 @@
+package cached
+
+import (
+	"container/list"
+	"log"
+	"sort"
+	"time"
+)
+
+// EvictionPolicy selects which entry is removed when the cache is full.
+type EvictionPolicy int
+
+const (
+	// FIFO evicts entries in the order they were inserted. It is the default
+	// and matches evicting the entry with the oldest insertion time.
+	FIFO EvictionPolicy = iota
+	// LRU evicts the least recently used entry, a cache hit counts as a use.
+	LRU
+	// LFU evicts the least frequently used entry, ties are broken by insertion order.
+	LFU
+)
+
+// String returns the name of the policy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case FIFO:
+		return "FIFO"
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	}
+	return "unknown"
+}
+
+// store inserts the computed value under key, evicting an entry first when the cache
+// is full. It must be called with fc.m held.
+func (fc *FunctionCache) store(key string, value interface{}) {
+	fc.storeFrom(key, value, SourceCompute)
+}
+
+// storeFrom is store for a value created by src. It must be called with fc.m held.
+func (fc *FunctionCache) storeFrom(key string, value interface{}, src Source) {
+	if _, found := fc.cache[key]; found {
+		fc.remove(key)
+	}
+
+	// Feature 4. Capacity limit, negatives have their own when limited
+	part := fc.partitionOf(key)
+	neg := fc.maxNegatives > 0 && fc.isNegative(value)
+	fc.inserts.Add(1)
+	switch {
+	case neg && len(fc.negs) >= fc.maxNegatives:
+		fc.fullInserts.Add(1)
+		fc.evictNegatives(fc.batch)
+	case !neg && fc.size(part) >= fc.capacity():
+		fc.fullInserts.Add(1)
+		fc.evict(fc.batch, part)
+	}
+
+	fc.cache[key] = value
+	fc.entry[key] = time.Now()
+	fc.sizes[key] = fc.sizeOf(value)
+	fc.bytes += int64(fc.sizes[key])
+	if stale, found := fc.stale[key]; found {
+		delete(fc.stale, key)
+		delete(fc.staleTime, key)
+		fc.discard(key, stale)
+	}
+	fc.elems[key] = fc.order.PushBack(key)
+	fc.record(EventAdd, key)
+	fc.sources[key] = src
+	fc.markDirty(key, value, src)
+	if fc.states != nil {
+		fc.states[key] = stateFresh
+	}
+	switch {
+	case neg:
+		fc.negs[key] = true
+	case fc.partition != nil:
+		fc.partSizes[part]++
+	}
+}
+
+// evict removes up to n positive entries of partition part selected by the eviction
+// policy, at least one. Without partitions part is ignored. It must be called with
+// fc.m held.
+func (fc *FunctionCache) evict(n int, part string) {
+	fc.evictWhere(n, func(key string) bool {
+		return fc.evictable(key, part)
+	})
+}
+
+// evictNegatives removes up to n negative entries selected by the eviction policy, at
+// least one. It must be called with fc.m held.
+func (fc *FunctionCache) evictNegatives(n int) {
+	fc.evictWhere(n, func(key string) bool {
+		return fc.negs[key] && !fc.pinned[key]
+	})
+}
+
+// evictWhere removes up to n of the entries for which eligible is true, selected by
+// the eviction policy, at least one. It must be called with fc.m held.
+func (fc *FunctionCache) evictWhere(n int, eligible func(key string) bool) {
+	victims := fc.victims(n, eligible)
+	if fc.minResidency > 0 {
+		// Prefer entries past their minimum residency, unless there are none
+		if older := fc.victims(n, func(key string) bool {
+			return eligible(key) && time.Since(fc.entry[key]) >= fc.minResidency
+		}); len(older) > 0 {
+			victims = older
+		}
+	}
+	for _, victim := range victims {
+		fc.removeAs(victim, EventEvict)
+		fc.evictions.Add(1)
+		fc.publish(EventEvict, victim)
+		log.Printf("Evicted %v entry: %v, cache size: %d\n", fc.policy, victim, len(fc.cache))
+	}
+}
+
+// remove deletes key and all its bookkeeping, releasing its value once the lock is
+// released. It must be called with fc.m held.
+func (fc *FunctionCache) remove(key string) {
+	fc.removeAs(key, EventDelete)
+}
+
+// removeAs is remove recording the removal as an event of type t for the audit sink.
+// It must be called with fc.m held.
+func (fc *FunctionCache) removeAs(key string, t EventType) {
+	if t == EventDelete {
+		fc.removeDependents(key)
+	}
+	value, found := fc.cache[key]
+	if !found {
+		return
+	}
+	fc.record(t, key)
+	if e, found := fc.elems[key]; found {
+		fc.order.Remove(e)
+	}
+	fc.bytes -= int64(fc.sizes[key])
+	delete(fc.cache, key)
+	delete(fc.entry, key)
+	delete(fc.sizes, key)
+	delete(fc.elems, key)
+	delete(fc.uses, key)
+	delete(fc.accessed, key)
+	delete(fc.ttls, key)
+	delete(fc.states, key)
+	delete(fc.sources, key)
+	if fc.negs[key] {
+		delete(fc.negs, key)
+	} else {
+		fc.unaccount(key)
+	}
+	fc.discard(key, value)
+}
+
+// touch records a cache hit of key. It must be called with fc.m held.
+func (fc *FunctionCache) touch(key string) {
+	fc.uses[key]++
+	fc.accessed[key] = time.Now()
+	if fc.policy == LRU {
+		fc.order.MoveToBack(fc.elems[key])
+	}
+}
+
+// each calls fn with every key in eviction order, so that scans over all entries do
+// not depend on map iteration order. It walks a snapshot of the keys, so fn may remove
+// any entries, e.g. with their dependents; keys removed before their turn are skipped.
+// It must be called with fc.m held.
+func (fc *FunctionCache) each(fn func(key string)) {
+	keys := make([]string, 0, fc.order.Len())
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	for _, key := range keys {
+		if _, found := fc.elems[key]; found {
+			fn(key)
+		}
+	}
+}
+
+// victims selects up to n eligible entries to evict, at least one unless none is
+// eligible. It must be called with fc.m held.
+func (fc *FunctionCache) victims(n int, eligible func(key string) bool) []string {
+	if fc.order.Len() == 0 {
+		return nil
+	}
+	if n < 1 {
+		n = 1
+	}
+	if fc.policy == LFU && n > 1 {
+		// Select the whole batch in one pass instead of scanning for every victim
+		keys := make([]string, 0, fc.order.Len())
+		for e := fc.order.Front(); e != nil; e = e.Next() {
+			if key := e.Value.(string); eligible(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return fc.uses[keys[i]] < fc.uses[keys[j]]
+		})
+		if n > len(keys) {
+			n = len(keys)
+		}
+		return keys[:n]
+	}
+	if fc.policy == LFU {
+		if victim, found := fc.leastUsed(eligible); found {
+			return []string{victim}
+		}
+		return nil
+	}
+
+	// The order list is kept in insertion (FIFO) or recency (LRU) order
+	victims := make([]string, 0, n)
+	for e := fc.order.Front(); e != nil && len(victims) < n; e = e.Next() {
+		if key := e.Value.(string); eligible(key) {
+			victims = append(victims, key)
+		}
+	}
+	return victims
+}
+
+// leastUsed returns the least frequently used eligible key, the oldest one on ties.
+// It must be called with fc.m held.
+func (fc *FunctionCache) leastUsed(eligible func(key string) bool) (string, bool) {
+	var victim *list.Element
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		if !eligible(e.Value.(string)) {
+			continue
+		}
+		if victim == nil || fc.uses[e.Value.(string)] < fc.uses[victim.Value.(string)] {
+			victim = e
+		}
+	}
+	if victim == nil {
+		return "", false
+	}
+	return victim.Value.(string), true
+}
+
+// evictable reports whether key may be evicted to make room for a positive entry in
+// partition part. It must be called with fc.m held.
+func (fc *FunctionCache) evictable(key, part string) bool {
+	return !fc.pinned[key] && !fc.negs[key] && (fc.partition == nil || fc.partitionOf(key) == part)
+}
@@ -0,0 +1,201 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: Each eviction policy picks the expected victim
+func TestCachedFunctionEvictionPolicies(t *testing.T) {
+	// mock cache size
+	defer func(size int) { MaxCacheSize = size }(MaxCacheSize)
+	MaxCacheSize = 3
+
+	tests := []struct {
+		policy EvictionPolicy
+		victim string
+	}{
+		{FIFO, "a"},
+		{LRU, "c"},
+		{LFU, "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			// mock cache
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fc := NewFunctionCache(ctx, WithEvictionPolicy(tt.policy))
+
+			// Define a simple function to be cached
+			f := func(args ...interface{}) interface{} {
+				return args[0]
+			}
+
+			// Create a cached version of the function
+			cachedFunc := fc.Wrap(f)
+
+			// Insert a, b, c and use them so that every policy picks a different victim
+			for _, arg := range []string{"a", "b", "c", "c", "c", "a", "a", "b"} {
+				cachedFunc(arg)
+			}
+
+			// Insert a new entry to trigger eviction
+			cachedFunc("d")
+
+			for _, arg := range []string{"a", "b", "c", "d"} {
+				_, ok := fc.cache[fmt.Sprintf("%v", []interface{}{arg})]
+				if arg == tt.victim && ok {
+					t.Errorf("Expected %v to be evicted", arg)
+				}
+				if arg != tt.victim && !ok {
+					t.Errorf("Expected %v to be retained", arg)
+				}
+			}
+		})
+	}
+}
+
+// Test: A full cache evicts a whole batch of the oldest entries at once
+func TestCachedFunctionEvictionBatch(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(8), WithEvictionBatch(4))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 9; i++ {
+		cachedFunc(i)
+	}
+
+	if len(fc.cache) != 5 {
+		t.Errorf("Expected 5 entries after evicting a batch of 4, got %d", len(fc.cache))
+	}
+	for i := 0; i < 4; i++ {
+		if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{i})]; ok {
+			t.Errorf("Expected entry %d to be evicted", i)
+		}
+	}
+}
+
+// Benchmark: inserts into a saturated LFU cache with different eviction batch sizes
+func BenchmarkCachedFunctionEvictionBatch(b *testing.B) {
+	for _, batch := range []int{1, 16} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			// mock cache
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fc := NewFunctionCache(ctx, WithMaxSize(1000), WithEvictionPolicy(LFU), WithEvictionBatch(batch))
+
+			// Create a cached version of a simple function
+			cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+				return args[0]
+			})
+
+			// Saturate the cache
+			for i := 0; i < 1000; i++ {
+				cachedFunc(-i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cachedFunc(i)
+			}
+		})
+	}
+}
+
+// Test: Evictions and expirations pick the same entries on every run
+func TestEvictionDeterministic(t *testing.T) {
+	run := func(policy EvictionPolicy) string {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var log []string
+		fc := NewFunctionCache(ctx, WithMaxSize(8), WithEvictionPolicy(policy), WithEvictionBatch(3),
+			WithAudit(func(e Event) {
+				if e.Type != EventAdd {
+					log = append(log, e.Type.String()+":"+e.Key)
+				}
+			}))
+		id := fc.Wrap(func(args ...interface{}) interface{} {
+			return args[0]
+		})
+
+		// Equal use counts leave every LFU victim to a tie break
+		for i := 0; i < 50; i++ {
+			id(i % 13)
+			id(i % 5)
+		}
+		fc.SetTTL(time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		fc.ExpireNow()
+		return fmt.Sprint(log)
+	}
+
+	for _, policy := range []EvictionPolicy{FIFO, LRU, LFU} {
+		want := run(policy)
+		if !strings.Contains(want, "evict:") || !strings.Contains(want, "expire:") {
+			t.Fatalf("%v: expected evictions and expirations, got %v", policy, want)
+		}
+		for i := 0; i < 20; i++ {
+			if got := run(policy); got != want {
+				t.Fatalf("%v: expected the same evictions on every run, got\n%v\nand\n%v", policy, want, got)
+			}
+		}
+	}
+}
+
+// Test: A just inserted entry is spared in favor of an older one
+func TestEvictionMinResidency(t *testing.T) {
+	for _, residency := range []time.Duration{0, 20 * time.Millisecond} {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fc := NewFunctionCache(ctx, WithMaxSize(3), WithEvictionPolicy(LFU), WithMinResidency(residency))
+		cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+			return args[0]
+		})
+
+		// a and b are old and used, c is new and unused
+		cachedFunc("a")
+		cachedFunc("b")
+		time.Sleep(30 * time.Millisecond)
+		for i := 0; i < 3; i++ {
+			cachedFunc("a")
+			cachedFunc("b")
+		}
+		cachedFunc("b")
+		cachedFunc("c")
+		cachedFunc("d")
+
+		_, spared := fc.EntryInfo("c")
+		_, kept := fc.EntryInfo("a")
+		if residency == 0 && (spared || !kept) {
+			t.Errorf("Expected LFU to evict the new entry without a residency window")
+		}
+		if residency > 0 && (!spared || kept) {
+			t.Errorf("Expected the new entry to be spared and the older a evicted")
+		}
+	}
+
+	// Without older candidates, young entries are evicted anyway
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(2), WithMinResidency(time.Minute))
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 5; i++ {
+		cachedFunc(i)
+	}
+	if size := fc.Stats().Size; size != 2 {
+		t.Errorf("Expected the capacity to hold, got %d entries", size)
+	}
+}
@@ -0,0 +1,36 @@
+package cached
+
+import "sync"
+
+// expiredKeys returns the expired keys in eviction order, checking them in parallel
+// on the expiry workers. The workers only read the maps, which is safe while the
+// caller holds fc.m. It must be called with fc.m held.
+func (fc *FunctionCache) expiredKeys() []string {
+	keys := make([]string, 0, fc.order.Len())
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+
+	expired := make([]bool, len(keys))
+	chunk := (len(keys) + fc.expiryWorkers - 1) / fc.expiryWorkers
+	var wg sync.WaitGroup
+	for start := 0; start < len(keys); start += chunk {
+		end := min(start+chunk, len(keys))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				expired[i] = fc.isExpired(keys[i])
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	out := keys[:0]
+	for i, key := range keys {
+		if expired[i] {
+			out = append(out, key)
+		}
+	}
+	return out
+}
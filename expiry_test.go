@@ -0,0 +1,72 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fill stores n entries, every other one already expired.
+func fill(fc *FunctionCache, n int) {
+	fc.lock()
+	defer fc.unlock()
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i)
+		fc.store(key, i)
+		if i%2 == 0 {
+			fc.entry[key] = old
+		}
+	}
+}
+
+// Test: Parallel sweeps remove the same entries in the same order as a single worker
+func TestExpiryWorkers(t *testing.T) {
+	sweep := func(workers int) string {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var removed []string
+		fc := NewFunctionCache(ctx, WithMaxSize(10000), WithTTL(time.Minute), WithExpiryWorkers(workers),
+			WithAudit(func(e Event) {
+				if e.Type == EventExpire {
+					removed = append(removed, e.Key)
+				}
+			}))
+		fill(fc, 1001)
+		fc.ExpireNow()
+		if stats := fc.Stats(); stats.Size != 500 || stats.Expirations != 501 {
+			t.Errorf("%d workers: expected 501 expirations leaving 500 entries, got %+v", workers, stats)
+		}
+		return fmt.Sprint(removed)
+	}
+
+	want := sweep(1)
+	for _, workers := range []int{2, 3, 8} {
+		if got := sweep(workers); got != want {
+			t.Errorf("%d workers: expected the same expirations as a single worker", workers)
+		}
+	}
+}
+
+// Benchmark: sweeps of a large cache with different numbers of expiry workers
+func BenchmarkExpiryWorkers(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			// mock cache
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fc := NewFunctionCache(ctx, WithMaxSize(200000), WithTTL(time.Minute), WithExpiryWorkers(workers))
+			fill(fc, 200000)
+			fc.ExpireNow()
+
+			// Sweeps over unexpired entries measure the scan alone
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				fc.ExpireNow()
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// WrapFileKeyed creates a cached version of a function processing the file whose path
+// is the argument at pathArgIndex. The modification time and size of the file are part
+// of the key, so a changed file is processed again while entries for its previous
+// versions expire through the normal TTL.
+func (fc *FunctionCache) WrapFileKeyed(f func(args ...interface{}) interface{}, pathArgIndex int) func(args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: WrapFileKeyed called with a nil function")
+	}
+	return func(args ...interface{}) interface{} {
+		args = fc.transformed(args)
+		path, _ := args[pathArgIndex].(string)
+		keyArgs := append(args[:len(args):len(args)], fileVersion(path))
+		// The version only goes into the key, f gets the arguments as passed
+		return fc.callContext(context.Background(), func(context.Context, ...interface{}) interface{} {
+			return f(args...)
+		}, keyArgs)
+	}
+}
+
+// fileVersion describes the current version of the file at path.
+func fileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+}
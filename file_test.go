@@ -0,0 +1,87 @@
+package cached
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test: A modified file is processed again
+func TestCachedFunctionFileKeyed(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+
+	// Define a function parsing the file
+	f := func(args ...interface{}) interface{} {
+		calls++
+		data, _ := os.ReadFile(args[0].(string))
+		return string(data)
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.WrapFileKeyed(f, 0)
+
+	cachedFunc(path)
+	if result := cachedFunc(path); result != "first" || calls != 1 {
+		t.Errorf("Expected cached result, got %v after %d calls", result, calls)
+	}
+
+	// Modify the file
+	if err := os.WriteFile(path, []byte("second version"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := cachedFunc(path); result != "second version" || calls != 2 {
+		t.Errorf("Expected fresh computation, got %v after %d calls", result, calls)
+	}
+}
+
+// Test: Callers over the waiter limit compute the file themselves instead of getting nil
+func TestCachedFunctionFileKeyedMaxWaiters(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxWaiters(1))
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	cachedFunc := fc.WrapFileKeyed(func(args ...interface{}) interface{} {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return "parsed"
+	}, 0)
+
+	results := make(chan interface{}, 3)
+	go func() { results <- cachedFunc(path) }()
+	<-started
+	for i := 0; i < 2; i++ {
+		go func() { results <- cachedFunc(path) }()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		if result := <-results; result != "parsed" {
+			t.Errorf("Expected every caller to get the parsed file, got %v", result)
+		}
+	}
+}
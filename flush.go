@@ -0,0 +1,24 @@
+package cached
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// flushEvery clears the cache at every wall-clock boundary that is a multiple of
+// interval since the zero time, e.g. at the top of every hour for time.Hour.
+func (fc *FunctionCache) flushEvery(ctx context.Context, interval time.Duration) {
+	for {
+		next := time.Now().Truncate(interval).Add(interval)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		log.Printf("Scheduled flush at %v\n", next)
+		fc.Clear()
+	}
+}
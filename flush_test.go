@@ -0,0 +1,37 @@
+package cached
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: The cache is flushed at the aligned boundary
+func TestCachedFunctionScheduledFlush(t *testing.T) {
+	interval := 200 * time.Millisecond
+
+	// Start right after a boundary
+	time.Sleep(time.Until(time.Now().Truncate(interval).Add(interval + 10*time.Millisecond)))
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithScheduledFlush(interval))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	boundary := time.Now().Truncate(interval).Add(interval)
+
+	time.Sleep(time.Until(boundary) - 50*time.Millisecond)
+	if size := fc.Stats().Size; size != 1 {
+		t.Errorf("Expected entry to be kept before the boundary, got %d entries", size)
+	}
+
+	time.Sleep(time.Until(boundary) + 50*time.Millisecond)
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected cache to be flushed at the boundary, got %d entries", size)
+	}
+}
@@ -0,0 +1,111 @@
+package cached
+
+import "log"
+
+// CachedE creates a strongly typed cached version of a function that may fail. Only
+// successful results are cached. On failure, including failed waits and timeouts, the
+// zero V and the error are returned without caching, and concurrent callers waiting
+// for the same key get the same error.
+func CachedE[K comparable, V any](fc *FunctionCache, f func(K) (V, error)) func(K) (V, error) {
+	if f == nil {
+		panic("cached: CachedE called with a nil function")
+	}
+	return func(k K) (V, error) {
+		result, err := fc.do([]interface{}{k}, func() (interface{}, error) {
+			return f(k)
+		})
+		// Failed waits carry an untyped nil, which must never reach the caller as V
+		var v V
+		if err != nil {
+			return v, err
+		}
+		if typed, ok := result.(V); ok {
+			v = typed
+		}
+		return v, nil
+	}
+}
+
+// pair holds the two results of a function cached by Cached2R.
+type pair[A, B any] struct {
+	a A
+	b B
+}
+
+// Cached2R creates a strongly typed cached version of a function returning two values,
+// such as a (data, meta) pair. Both values are stored together as one entry.
+func Cached2R[K comparable, A, B any](fc *FunctionCache, f func(K) (A, B)) func(K) (A, B) {
+	if f == nil {
+		panic("cached: Cached2R called with a nil function")
+	}
+	return func(k K) (A, B) {
+		result, err := fc.do([]interface{}{k}, func() (interface{}, error) {
+			a, b := f(k)
+			return pair[A, B]{a: a, b: b}, nil
+		})
+		if err != nil {
+			log.Printf("No result available, returning zero values: %v\n", err)
+		}
+		p, _ := result.(pair[A, B])
+		return p.a, p.b
+	}
+}
+
+// CachedChan creates a cached version of a function returning a channel, which could
+// only be drained once if cached as is. The channel is drained into a slice on a miss
+// and every call gets a fresh channel replaying it. Channels with more than maxItems
+// items are not cached: the caller computing them gets all items as they come and
+// callers waiting for it call f themselves.
+func CachedChan[K comparable, T any](fc *FunctionCache, f func(K) <-chan T, maxItems int) func(K) <-chan T {
+	if f == nil {
+		panic("cached: CachedChan called with a nil function")
+	}
+	return func(k K) <-chan T {
+		// Only the leader's own channel is set when it cannot be cached
+		var own <-chan T
+		result, err := fc.do([]interface{}{k}, func() (interface{}, error) {
+			ch := f(k)
+			var items []T
+			for item := range ch {
+				items = append(items, item)
+				if len(items) > maxItems {
+					own = resume(items, ch)
+					return nil, errUncacheable
+				}
+			}
+			return items, nil
+		})
+		switch {
+		case own != nil:
+			return own
+		case err != nil:
+			log.Printf("No result available, calling function: %v\n", err)
+			return f(k)
+		}
+		items, _ := result.([]T)
+		return resume(items, nil)
+	}
+}
+
+// resume returns a channel replaying items and then the rest of ch, if not nil.
+func resume[T any](items []T, ch <-chan T) <-chan T {
+	if ch == nil {
+		out := make(chan T, len(items))
+		for _, item := range items {
+			out <- item
+		}
+		close(out)
+		return out
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for _, item := range items {
+			out <- item
+		}
+		for item := range ch {
+			out <- item
+		}
+	}()
+	return out
+}
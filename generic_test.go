@@ -0,0 +1,228 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Typed successful results are cached
+func TestCachedESuccess(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+
+	// Create a typed cached function
+	square := CachedE(fc, func(n int) (int, error) {
+		calls++
+		return n * n, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, err := square(4); v != 16 || err != nil {
+			t.Errorf("Expected 16, got %v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+}
+
+// Test: Errors are not cached
+func TestCachedEErrorNotCached(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+
+	// Create a typed cached function which always fails
+	lookup := CachedE(fc, func(id string) (string, error) {
+		calls++
+		return "ignored", errors.New("not available")
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, err := lookup("a"); v != "" || err == nil {
+			t.Errorf("Expected zero value and error, got %q, %v", v, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected function to be called for every failed call, but it was called %d times", calls)
+	}
+}
+
+// Test: Concurrent callers share the error of one computation
+func TestCachedEConcurrentErrors(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+	errDown := errors.New("backend down")
+
+	// Create a slow typed cached function which fails
+	lookup := CachedE(fc, func(id string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "", errDown
+	})
+
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := lookup("a"); errors.Is(err, errDown) {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed != 10 {
+		t.Errorf("Expected all callers to get the error, got %d", failed)
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+}
+
+// Test: Both results of a two-value function are cached and shared with waiters
+func TestCached2R(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+
+	// Create a typed cached function returning data and metadata
+	fetch := Cached2R(fc, func(id string) ([]byte, time.Time) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("data:" + id), time.Unix(42, 0)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, meta := fetch("x")
+			if string(data) != "data:x" || !meta.Equal(time.Unix(42, 0)) {
+				t.Errorf("Unexpected results: %s, %v", data, meta)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, meta := fetch("x")
+	if string(data) != "data:x" || !meta.Equal(time.Unix(42, 0)) {
+		t.Errorf("Unexpected cached results: %s, %v", data, meta)
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+}
+
+// Test: Every caller of a cached channel function gets a full replay
+func TestCachedChan(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+
+	// Create a cached function streaming n items
+	stream := CachedChan(fc, func(n int) <-chan int {
+		atomic.AddInt32(&calls, 1)
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; i < n; i++ {
+				ch <- i
+			}
+		}()
+		return ch
+	}, 5)
+
+	drain := func(ch <-chan int) (sum, count int) {
+		for item := range ch {
+			sum += item
+			count++
+		}
+		return sum, count
+	}
+
+	for i := 0; i < 3; i++ {
+		if sum, count := drain(stream(5)); sum != 10 || count != 5 {
+			t.Errorf("Expected a full replay, got %d items summing to %d", count, sum)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+
+	// Streams over the limit are passed on whole but not cached
+	for i := 0; i < 2; i++ {
+		if sum, count := drain(stream(10)); sum != 45 || count != 10 {
+			t.Errorf("Expected all items of a long stream, got %d items summing to %d", count, sum)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected long streams not to be cached, function was called %d times", calls)
+	}
+}
+
+// Test: Failed computations and waits return the zero value of a value type
+func TestCachedEZeroValueOnFailure(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithComputeTimeout(20*time.Millisecond))
+
+	// Create a slow typed cached function
+	count := CachedE(fc, func(n int) (int, error) {
+		time.Sleep(50 * time.Millisecond)
+		return n, nil
+	})
+
+	// The leader times out and its waiters fail with it
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := count(1); v != 0 || !errors.Is(err, ErrComputeTimeout) {
+				t.Errorf("Expected 0 and a timeout error, got %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Without a timeout, waiters of a panicking leader get no result
+	fc = NewFunctionCache(ctx)
+	count = CachedE(fc, func(n int) (int, error) {
+		time.Sleep(50 * time.Millisecond)
+		panic("negative")
+	})
+	go func() {
+		defer func() { recover() }()
+		count(-1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if v, err := count(-1); v != 0 || !errors.Is(err, ErrNoResult) {
+		t.Errorf("Expected 0 and no result, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,31 @@
+package cached
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// goidBuffers recycles the buffers the stack headers are read into, which escape.
+var goidBuffers = sync.Pool{
+	New: func() interface{} {
+		return new([64]byte)
+	},
+}
+
+// goid returns the id of the current goroutine, parsed from the header of its stack
+// trace, or 0 if it cannot be determined.
+func goid() uint64 {
+	buf := goidBuffers.Get().(*[64]byte)
+	defer goidBuffers.Put(buf)
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	var id uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
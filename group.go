@@ -0,0 +1,248 @@
+package cached
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrTooManyWaiters is returned when a key already has the maximum number of waiters.
+var ErrTooManyWaiters = errors.New("cached: too many waiters")
+
+// ErrRecursiveCall is returned when the computation of a key calls for the same key
+// on its own goroutine, which would otherwise wait for itself forever.
+var ErrRecursiveCall = errors.New("cached: recursive call for key being computed")
+
+// ErrNoResult is returned to waiters when the computation they waited for did not
+// complete, e.g. because it panicked.
+var ErrNoResult = errors.New("cached: in-flight computation did not complete")
+
+// Group deduplicates concurrent computations of the same key, like
+// golang.org/x/sync/singleflight. It holds no results once a computation is
+// done, so several caches (or plain functions) can share one Group to
+// coalesce calls hitting the same backend even though their storage differs.
+type Group struct {
+	m     sync.Mutex
+	calls map[string]*call
+}
+
+// call is an in-flight computation of a single key that waiters block on.
+type call struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	done   bool
+	result interface{}
+	err    error
+	waits  int // waiters of this call only, reset when it is recycled
+	refs   int
+	leader uint64
+	start  time.Time
+	stack  []byte
+	after  []func()
+}
+
+// calls recycles call structs, with their mutex and condition variable, once the
+// leader and all waiters are done with them, to spare allocations under key churn.
+var calls = sync.Pool{
+	New: func() interface{} {
+		c := &call{}
+		c.cond = sync.NewCond(&c.m)
+		return c
+	},
+}
+
+// NewGroup creates a new Group.
+func NewGroup() *Group {
+	return &Group{calls: make(map[string]*call)}
+}
+
+// Do runs fn for key and returns its result. If a computation of key is
+// already in flight, Do waits for it instead and returns its result with
+// shared set to true. In DEBUG mode, calls made by fn for the same key get
+// ErrRecursiveCall instead of waiting for themselves.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (result interface{}, err error, shared bool) {
+	return g.do(key, 0, false, fn)
+}
+
+// do is Do with at most maxWaiters waiters per key, zero meaning no limit.
+// Callers beyond the limit get ErrTooManyWaiters instead of waiting. With check set,
+// or in DEBUG mode, recursive calls are detected, which costs a stack header parse
+// per call.
+func (g *Group) do(key string, maxWaiters int, check bool, fn func() (interface{}, error)) (result interface{}, err error, shared bool) {
+	var id uint64
+	if check || debug.Load() {
+		id = goid()
+	}
+	lock(&g.m)
+	if c, found := g.calls[key]; found {
+		if id != 0 && c.leader == id {
+			g.m.Unlock()
+			log.Printf("Recursive call for slot: %v\n", key)
+			return nil, ErrRecursiveCall, false
+		}
+		if maxWaiters > 0 && c.waits >= maxWaiters {
+			// Calls are recycled, so nothing of c may be read once g.m is released
+			waits := c.waits
+			g.m.Unlock()
+			log.Printf("Too many waiters for slot: %v, waits: %d\n", key, waits)
+			return nil, ErrTooManyWaiters, false
+		}
+		c.waits++
+		c.m.Lock()
+		c.refs++
+		c.m.Unlock()
+		log.Printf("Waiting for slot: %v, waits: %d\n", key, c.waits)
+		g.m.Unlock()
+		result, err = c.wait()
+		return result, err, true
+	}
+	c := newCall()
+	c.leader = id
+	c.start = time.Now()
+	if debug.Load() {
+		c.stack = stack()
+	}
+	g.calls[key] = c
+	g.m.Unlock()
+
+	// Waiters must be woken up even if fn panics
+	completed := false
+	defer func() {
+		if !completed {
+			g.done(key, c, nil, ErrNoResult)
+		}
+	}()
+	result, err = fn()
+	completed = true
+	g.done(key, c, result, err)
+	return result, err, false
+}
+
+// done removes the call of key and wakes up its waiters.
+func (g *Group) done(key string, c *call, result interface{}, err error) {
+	lock(&g.m)
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.m.Unlock()
+	log.Printf("Notifying waiters for slot: %v\n", key)
+	c.finish(result, err)
+	c.release()
+}
+
+// Forget makes the next Do for key start a new computation instead of waiting for
+// the one in flight. Callers already waiting still get the result of the old one.
+func (g *Group) Forget(key string) {
+	lock(&g.m)
+	defer g.m.Unlock()
+	delete(g.calls, key)
+}
+
+// InFlight returns the number of keys being computed and how long the oldest of
+// these computations has been running, zero if none is, e.g. for a health check to
+// detect stuck leaders.
+func (g *Group) InFlight() (keys int, oldest time.Duration) {
+	lock(&g.m)
+	defer g.m.Unlock()
+	now := time.Now()
+	for _, c := range g.calls {
+		if age := now.Sub(c.start); age > oldest {
+			oldest = age
+		}
+	}
+	return len(g.calls), oldest
+}
+
+// newCall takes an in-flight call, referenced by its leader, from the pool.
+func newCall() *call {
+	c := calls.Get().(*call)
+	c.refs = 1
+	return c
+}
+
+// wait blocks until the leader has finished the call and returns its result.
+func (c *call) wait() (interface{}, error) {
+	c.m.Lock()
+	for !c.done {
+		c.cond.Wait()
+	}
+	result, err := c.result, c.err
+	c.m.Unlock()
+	c.release()
+	return result, err
+}
+
+// release drops a reference to the call, returning it to the pool after the last one.
+func (c *call) release() {
+	c.m.Lock()
+	c.refs--
+	if c.refs > 0 {
+		c.m.Unlock()
+		return
+	}
+	c.done = false
+	c.result = nil
+	c.err = nil
+	c.waits = 0
+	c.leader = 0
+	c.start = time.Time{}
+	c.stack = nil
+	c.after = nil
+	c.m.Unlock()
+	calls.Put(c)
+}
+
+// finish publishes the result and wakes all waiters, unless the call was resolved.
+func (c *call) finish(result interface{}, err error) {
+	c.m.Lock()
+	if c.done {
+		// Resolved before the leader finished, see Group.resolve
+		c.m.Unlock()
+		return
+	}
+	c.result = result
+	c.err = err
+	c.done = true
+	c.cond.Broadcast()
+	c.m.Unlock()
+	for _, fn := range c.after {
+		fn()
+	}
+}
+
+// resolve hands result to the waiters of the computation of key in flight, which
+// return it right away instead of waiting for the leader, and makes the next Do for
+// key start a new computation. The leader finishes its computation regardless and
+// returns its own result. It reports whether a computation was in flight.
+func (g *Group) resolve(key string, result interface{}) bool {
+	lock(&g.m)
+	c, found := g.calls[key]
+	if !found {
+		g.m.Unlock()
+		return false
+	}
+	delete(g.calls, key)
+	// The reference keeps the call from being recycled if the leader finishes now
+	c.m.Lock()
+	c.refs++
+	c.m.Unlock()
+	g.m.Unlock()
+	log.Printf("Resolving waiters for slot: %v\n", key)
+	c.finish(result, nil)
+	c.release()
+	return true
+}
+
+// after schedules fn to run once the in-flight computation of key has finished.
+// It reports false, without scheduling fn, when nothing is in flight for key.
+func (g *Group) after(key string, fn func()) bool {
+	lock(&g.m)
+	defer g.m.Unlock()
+	c, found := g.calls[key]
+	if !found {
+		return false
+	}
+	c.after = append(c.after, fn)
+	return true
+}
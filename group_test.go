@@ -0,0 +1,122 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Two caches sharing a Group coalesce concurrent calls with the same key
+func TestGroupSharedBetweenCaches(t *testing.T) {
+	// mock caches sharing one group
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := NewGroup()
+	fc1 := NewFunctionCache(ctx, WithGroup(g))
+	fc2 := NewFunctionCache(ctx, WithGroup(g))
+
+	var calls int32
+
+	// Define a slow backend call
+	backend := func(args ...interface{}) interface{} {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return args[0]
+	}
+
+	// Create two different cached versions of the backend call
+	cachedFunc1 := fc1.Wrap(backend)
+	cachedFunc2 := fc2.Wrap(func(args ...interface{}) interface{} {
+		return backend(args...)
+	})
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				results[i] = cachedFunc1("id")
+			} else {
+				results[i] = cachedFunc2("id")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected backend to be called once, but it was called %d times", calls)
+	}
+	for i, result := range results {
+		if result != "id" {
+			t.Errorf("Expected result %d to be %v, got %v", i, "id", result)
+		}
+	}
+}
+
+// Benchmark: In-flight state of many distinct keys
+func BenchmarkGroupDistinctKeys(b *testing.B) {
+	g := NewGroup()
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	fn := func() (interface{}, error) {
+		return nil, nil
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			g.Do(keys[i%len(keys)], fn)
+			i++
+		}
+	})
+}
+
+// Test: A cached function calling itself for the same key does not deadlock
+func TestCachedFunctionRecursiveCall(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var cachedFunc func(args ...interface{}) interface{}
+	var depth int
+	cachedFunc = fc.Wrap(func(args ...interface{}) interface{} {
+		depth++
+		if depth == 1 {
+			// Re-enter once with the same arguments
+			return cachedFunc(args...).(int) + 1
+		}
+		return 1
+	})
+
+	result := make(chan interface{})
+	go func() {
+		result <- cachedFunc("x")
+	}()
+	select {
+	case r := <-result:
+		if r != 2 {
+			t.Errorf("Expected the recursive call to be computed directly, got %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Recursive call deadlocked")
+	}
+
+	// The error is reported to functions which can return one
+	var errorFunc func(args ...interface{}) (interface{}, error)
+	errorFunc = fc.WrapE(func(args ...interface{}) (interface{}, error) {
+		return errorFunc(args...)
+	})
+	if _, err := errorFunc("y"); !errors.Is(err, ErrRecursiveCall) {
+		t.Errorf("Expected a recursive call error, got %v", err)
+	}
+}
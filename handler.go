@@ -0,0 +1,36 @@
+package cached
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns an HTTP handler for administering the cache, meant to be mounted
+// on an admin mux (with http.StripPrefix when mounted below a prefix):
+//
+//	GET  /stats            cache statistics as JSON
+//	POST /clear            removes all entries
+//	POST /delete?key=KEY   removes the entry stored under KEY
+func (fc *FunctionCache) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(fc.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("POST /clear", func(w http.ResponseWriter, r *http.Request) {
+		fc.Clear()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /delete", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "missing key", http.StatusBadRequest)
+			return
+		}
+		fc.deleteKey(key)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,53 @@
+package cached
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: The admin handler exposes stats and clears the cache
+func TestFunctionCacheHandler(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	cachedFunc(1)
+
+	srv := httptest.NewServer(fc.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats Stats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hits != 1 || stats.Size != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	resp, err = http.Post(srv.URL+"/clear", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected cache to be cleared, got %d entries", size)
+	}
+}
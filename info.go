@@ -0,0 +1,124 @@
+package cached
+
+import (
+	"log"
+	"time"
+)
+
+// Source tells which code path created a cache entry.
+type Source int
+
+const (
+	// SourceCompute is an entry computed by a wrapped function
+	SourceCompute Source = iota
+	// SourceSet is an entry stored by Set, Swap or CompareAndSwap
+	SourceSet
+	// SourceStore is an entry stored through AsStore, e.g. by a TwoLevel cache or a Client
+	SourceStore
+	// SourceSnapshot is an entry loaded from the snapshot of a persistent cache
+	SourceSnapshot
+)
+
+// String returns the name of the source.
+func (s Source) String() string {
+	switch s {
+	case SourceCompute:
+		return "compute"
+	case SourceSet:
+		return "set"
+	case SourceStore:
+		return "store"
+	case SourceSnapshot:
+		return "snapshot"
+	}
+	return "unknown"
+}
+
+// EntryInfo describes a cache entry without its value.
+type EntryInfo struct {
+	Key        string        `json:"key"`
+	Age        time.Duration `json:"age"`
+	LastAccess time.Time     `json:"last_access"`
+	Accesses   int           `json:"accesses"`
+	Size       int           `json:"size"`
+	Pinned     bool          `json:"pinned"`
+	Source     Source        `json:"source"`
+}
+
+// EntryInfo returns the metadata of the entry for the given arguments. LastAccess is
+// the time of the last hit, or of storing the entry if it was never hit. Accesses
+// counts the hits and Source tells how the entry was created.
+func (fc *FunctionCache) EntryInfo(args ...interface{}) (EntryInfo, bool) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return EntryInfo{}, false
+	}
+	fc.lock()
+	defer fc.unlock()
+	if _, found := fc.cache[key]; !found {
+		return EntryInfo{}, false
+	}
+	return fc.info(key, time.Now()), true
+}
+
+// ListEntryInfo returns the metadata of all entries in eviction order.
+func (fc *FunctionCache) ListEntryInfo() []EntryInfo {
+	fc.lock()
+	defer fc.unlock()
+	now := time.Now()
+	infos := make([]EntryInfo, 0, len(fc.cache))
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		infos = append(infos, fc.info(e.Value.(string), now))
+	}
+	return infos
+}
+
+// info returns the metadata of the entry of key. It must be called with fc.m held.
+func (fc *FunctionCache) info(key string, now time.Time) EntryInfo {
+	lastAccess, found := fc.accessed[key]
+	if !found {
+		lastAccess = fc.entry[key]
+	}
+	return EntryInfo{
+		Key:        key,
+		Age:        now.Sub(fc.entry[key]),
+		LastAccess: lastAccess,
+		Accesses:   fc.uses[key],
+		Size:       fc.sizes[key],
+		Pinned:     fc.pinned[key],
+		Source:     fc.sources[key],
+	}
+}
+
+// RangeSnapshot calls fn with the key and value of every entry present when it is
+// called, in eviction order, until fn returns false. Only copying the keys holds the
+// lock, then each value is looked up under the lock on its own and fn runs outside of
+// it, so long iterations do not stall the cache and fn may use it. Entries removed
+// meanwhile are skipped and entries added meanwhile are not visited, a replaced entry
+// yields its current value.
+func (fc *FunctionCache) RangeSnapshot(fn func(key string, value interface{}) bool) {
+	fc.lock()
+	keys := make([]string, 0, len(fc.cache))
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	fc.unlock()
+
+	for _, key := range keys {
+		fc.lock()
+		stored, found := fc.cache[key]
+		fc.unlock()
+		if !found {
+			continue
+		}
+		value, err := fc.decode(stored)
+		if err != nil {
+			log.Printf("Skipping undecodable entry: %v, %v\n", key, err)
+			continue
+		}
+		if !fn(key, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cached
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test: Entry metadata reflects the activity on the entries
+func TestFunctionCacheEntryInfo(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	start := time.Now()
+	cachedFunc("hot")
+	cachedFunc("cold")
+	time.Sleep(20 * time.Millisecond)
+	cachedFunc("hot")
+	cachedFunc("hot")
+
+	info, found := fc.EntryInfo("hot")
+	if !found {
+		t.Fatalf("Expected the entry to be found")
+	}
+	if info.Accesses != 2 || info.Age < 20*time.Millisecond || info.Size != len("hot") {
+		t.Errorf("Unexpected metadata: %+v", info)
+	}
+	if info.LastAccess.Sub(start) < 20*time.Millisecond {
+		t.Errorf("Expected the last access to be the last hit, got %v", info.LastAccess)
+	}
+	if _, found := fc.EntryInfo("missing"); found {
+		t.Errorf("Expected no metadata for a missing entry")
+	}
+
+	infos := fc.ListEntryInfo()
+	if len(infos) != 2 || infos[0].Key != "[hot]" || infos[1].Accesses != 0 {
+		t.Errorf("Unexpected metadata list: %+v", infos)
+	}
+}
+
+// Test: Entries are tagged with the code path which created them
+func TestEntryInfoSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+
+	// mock cache
+	fc := NewPersistentFunctionCache(context.Background(), path)
+	fc.Wrap(func(args ...interface{}) interface{} { return 1 })("computed")
+	fc.Close()
+
+	fc = NewPersistentFunctionCache(context.Background(), path)
+	defer fc.Close()
+	fc.Wrap(func(args ...interface{}) interface{} { return 2 })("recomputed")
+	fc.Set(3, "set")
+	fc.Swap(4, "recomputed")
+	fc.AsStore().Set(DefaultKey("stored"), 5, time.Minute)
+
+	for arg, want := range map[string]Source{
+		"computed":   SourceSnapshot,
+		"recomputed": SourceSet,
+		"set":        SourceSet,
+		"stored":     SourceStore,
+	} {
+		if info, found := fc.EntryInfo(arg); !found || info.Source != want {
+			t.Errorf("Expected %v to come from %v, got %v, %v", arg, want, info.Source, found)
+		}
+	}
+
+	fc.Delete("set")
+	fc.Wrap(func(args ...interface{}) interface{} { return 6 })("set")
+	if info, _ := fc.EntryInfo("set"); info.Source != SourceCompute {
+		t.Errorf("Expected a recomputed entry to come from compute, got %v", info.Source)
+	}
+}
+
+// Test: Iterating a snapshot of a large cache tolerates concurrent deletes
+func TestRangeSnapshot(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(20000))
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 10000; i++ {
+		cachedFunc(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i += 2 {
+			fc.Delete(i)
+		}
+	}()
+
+	visited := 0
+	fc.RangeSnapshot(func(key string, value interface{}) bool {
+		if key != DefaultKey(value) {
+			t.Errorf("Expected the value of %v, got %v", key, value)
+		}
+		visited++
+		// fn may use the cache
+		fc.Stats()
+		return true
+	})
+	<-done
+	if visited < 5000 || visited > 10000 {
+		t.Errorf("Expected at least the odd entries to be visited, got %d", visited)
+	}
+
+	visited = 0
+	fc.RangeSnapshot(func(key string, value interface{}) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("Expected the iteration to stop when fn returns false, got %d", visited)
+	}
+}
@@ -0,0 +1,31 @@
+package cached
+
+import (
+	"context"
+	"log"
+)
+
+// invalidateOn removes the entries matching every event received on ch until ch is
+// closed or ctx is done.
+func (fc *FunctionCache) invalidateOn(ctx context.Context, ch <-chan string, match func(key, event string) bool) {
+	for {
+		var event string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok = <-ch:
+			if !ok {
+				return
+			}
+		}
+		fc.lock()
+		fc.each(func(key string) {
+			if match(key, event) {
+				log.Printf("Invalidating on event %v: %v\n", event, key)
+				fc.remove(key)
+			}
+		})
+		fc.unlock()
+	}
+}
@@ -0,0 +1,49 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test: Entries matching an external event are removed and recomputed
+func TestCachedFunctionInvalidateOn(t *testing.T) {
+	events := make(chan string)
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx,
+		WithKeyFunc(func(args ...interface{}) string {
+			return fmt.Sprintf("user:%v", args[0])
+		}),
+		WithInvalidateOn(events, func(key, event string) bool {
+			return key == "user:"+event
+		}),
+	)
+
+	calls := make(map[interface{}]int)
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls[args[0]]++
+		return calls[args[0]]
+	})
+	cachedFunc(1)
+	cachedFunc(2)
+
+	events <- "1"
+	deadline := time.Now().Add(time.Second)
+	for fc.Stats().Size != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if size := fc.Stats().Size; size != 1 {
+		t.Fatalf("Expected only the matching entry to be removed, got %d entries", size)
+	}
+	if result := cachedFunc(1); result != 2 {
+		t.Errorf("Expected the invalidated entry to be recomputed, got %v", result)
+	}
+	if result := cachedFunc(2); result != 1 {
+		t.Errorf("Expected the other entry to be served from the cache, got %v", result)
+	}
+}
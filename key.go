@@ -0,0 +1,465 @@
+package cached
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CacheKeyer is implemented by arguments that provide their own cache key.
+type CacheKeyer interface {
+	CacheKey() string
+}
+
+// maxKeyDepth bounds how deep pointers and nested structs are followed in keys
+const maxKeyDepth = 32
+
+// DefaultKey builds the key used when no key function is configured. Arguments are
+// formatted with %v, except for CacheKeyer implementations which supply their own key
+// and structs (or pointers to them) which are keyed on their exported fields with
+// pointers followed, so that pointer addresses never end up in the key. Structs
+// implementing encoding.TextMarshaler or fmt.Stringer, like time.Time, are keyed on
+// their text, and structs without exported fields are formatted with %v.
+func DefaultKey(args ...interface{}) string {
+	plain := true
+	for _, arg := range args {
+		if _, ok := arg.(CacheKeyer); ok || isStruct(reflect.ValueOf(arg)) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return fmt.Sprintf("%v", args)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		if k, ok := arg.(CacheKeyer); ok {
+			sb.WriteString(k.CacheKey())
+			continue
+		}
+		writeValueKey(&sb, reflect.ValueOf(arg), 0)
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// TypedKey builds a key from the argument count and the type and DefaultKey of every
+// argument, length prefixed, so that f(1, 2) and f("1 2") cannot collide like
+// they do with the plain %v formatting.
+func TypedKey(args ...interface{}) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", len(args))
+	for _, arg := range args {
+		key := DefaultKey(arg)
+		fmt.Fprintf(&sb, "|%T:%d:%s", arg, len(key), key)
+	}
+	return sb.String()
+}
+
+// FoldTail returns a fixed length digest of args, e.g. the variadic tail of a call,
+// which differs for tails differing in any argument, type or count. Used as a single
+// key argument it keeps keys bounded however long the tails get, see WithFoldedTail.
+func FoldTail(args ...interface{}) string {
+	sum := sha256.Sum256([]byte(TypedKey(args...)))
+	return "tail:" + hex.EncodeToString(sum[:])
+}
+
+// folded returns args with the arguments from the folding position on replaced by
+// their FoldTail.
+func (fc *FunctionCache) folded(args []interface{}) []interface{} {
+	if !fc.foldTail || len(args) <= fc.foldFrom {
+		return args
+	}
+	out := make([]interface{}, fc.foldFrom, fc.foldFrom+1)
+	copy(out, args)
+	return append(out, FoldTail(args[fc.foldFrom:]...))
+}
+
+// transformed returns args as transformed by the argument transform, if any. It is
+// applied once per call, before both keying and computing.
+func (fc *FunctionCache) transformed(args []interface{}) []interface{} {
+	if fc.transform == nil {
+		return args
+	}
+	return fc.transform(args)
+}
+
+// selected returns the arguments at the key positions, or all of them if none are set.
+func (fc *FunctionCache) selected(args []interface{}) []interface{} {
+	if fc.keyArgs == nil {
+		return args
+	}
+	out := make([]interface{}, 0, len(fc.keyArgs))
+	for _, i := range fc.keyArgs {
+		if i < len(args) {
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
+
+// normalized returns a copy of args with all string arguments normalized and all
+// arguments canonicalized.
+func (fc *FunctionCache) normalized(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok && fc.normalize != nil {
+			arg = fc.normalize(s)
+		}
+		if fc.canonical != nil {
+			arg = fc.canonical(arg)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// Canonical maps semantically equal arguments which print differently to one value,
+// for use with WithCanonicalizer: negative zero floats to zero and times to UTC
+// without their monotonic clock reading. Other arguments are returned as they are.
+func Canonical(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case float64:
+		if v == 0 {
+			return float64(0)
+		}
+	case float32:
+		if v == 0 {
+			return float32(0)
+		}
+	case time.Time:
+		return v.UTC().Round(0)
+	}
+	return arg
+}
+
+// uncacheable reports whether any argument is of a kind without a meaningful key
+// (functions, channels and unsafe pointers) or of a type registered to bypass the cache.
+func (fc *FunctionCache) uncacheable(args []interface{}) bool {
+	for _, arg := range args {
+		t := reflect.TypeOf(arg)
+		if t == nil {
+			continue
+		}
+		switch {
+		case fc.bypass[t]:
+			log.Printf("Bypassing cache for argument of type %v\n", t)
+			return true
+		case t.Kind() == reflect.Func, t.Kind() == reflect.Chan, t.Kind() == reflect.UnsafePointer:
+			log.Printf("Warning: argument of type %v cannot be keyed, bypassing cache\n", t)
+			return true
+		}
+	}
+	return false
+}
+
+// missingKey reports whether a call lacks the idempotency key set by WithIdempotencyKey.
+func (fc *FunctionCache) missingKey(args []interface{}) bool {
+	if !fc.idempotent {
+		return false
+	}
+	key := fc.selected(args)
+	if len(key) == 0 || key[0] == nil || key[0] == "" {
+		log.Printf("Missing idempotency key, bypassing cache: %v\n", args)
+		return true
+	}
+	return false
+}
+
+// isStruct reports whether v is a struct or a pointer to one.
+func isStruct(v reflect.Value) bool {
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Struct
+}
+
+// writeValueKey writes the key of v, following pointers and using only the exported fields of structs.
+func writeValueKey(sb *strings.Builder, v reflect.Value, depth int) {
+	if depth > maxKeyDepth {
+		sb.WriteString("...")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		sb.WriteString("<nil>")
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			sb.WriteString("<nil>")
+			return
+		}
+		if v.CanInterface() {
+			if k, ok := v.Interface().(CacheKeyer); ok {
+				sb.WriteString(k.CacheKey())
+				return
+			}
+		}
+		writeValueKey(sb, v.Elem(), depth+1)
+	case reflect.Struct:
+		if writeTextKey(sb, v) {
+			return
+		}
+		t := v.Type()
+		if !hasExported(t) {
+			// Nothing would tell such values apart, e.g. all fields of time.Time are unexported
+			fmt.Fprintf(sb, "%v", v)
+			return
+		}
+		sb.WriteString(t.String())
+		sb.WriteByte('{')
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if n > 0 {
+				sb.WriteByte(' ')
+			}
+			n++
+			sb.WriteString(t.Field(i).Name)
+			sb.WriteByte(':')
+			writeValueKey(sb, v.Field(i), depth+1)
+		}
+		sb.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		sb.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			writeValueKey(sb, v.Index(i), depth+1)
+		}
+		sb.WriteByte(']')
+	default:
+		if !v.CanInterface() {
+			// fmt formats the value held by v even where Interface is not allowed
+			fmt.Fprintf(sb, "%v", v)
+			return
+		}
+		if k, ok := v.Interface().(CacheKeyer); ok {
+			sb.WriteString(k.CacheKey())
+			return
+		}
+		fmt.Fprintf(sb, "%v", v.Interface())
+	}
+}
+
+// writeTextKey writes the text of a struct implementing encoding.TextMarshaler or
+// fmt.Stringer and reports whether it did.
+func writeTextKey(sb *strings.Builder, v reflect.Value) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	var text string
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return false
+		}
+		text = string(b)
+	} else if s, ok := v.Interface().(fmt.Stringer); ok {
+		text = s.String()
+	} else {
+		return false
+	}
+	sb.WriteString(v.Type().String())
+	sb.WriteByte('(')
+	sb.WriteString(text)
+	sb.WriteByte(')')
+	return true
+}
+
+// hasExported reports whether the struct type t has an exported field.
+func hasExported(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind tags written ahead of every value so that structurally different
+// arguments never hash to the same byte stream.
+const (
+	tagNil byte = iota
+	tagBool
+	tagInt
+	tagUint
+	tagFloat
+	tagComplex
+	tagString
+	tagBytes
+	tagList
+	tagMap
+	tagStruct
+	tagPointer
+	tagOpaque
+	tagType
+)
+
+// HashKey builds a cache key by streaming the arguments into a 128-bit FNV-1a
+// hash instead of formatting them into one large string. It is meant to be
+// used with WithKeyFunc for functions taking big slices, maps or structs.
+// Map entries are combined independently of iteration order.
+func HashKey(args ...interface{}) string {
+	kh := keyHasher{h: fnv.New128a()}
+	kh.writeUint(tagList, uint64(len(args)))
+	for _, arg := range args {
+		kh.write(reflect.ValueOf(arg))
+	}
+	return hex.EncodeToString(kh.h.Sum(nil))
+}
+
+// keyHasher walks values with reflection and writes their bytes to h.
+type keyHasher struct {
+	h       hash.Hash
+	buf     [64]byte
+	visited map[uintptr]bool
+}
+
+func (kh *keyHasher) writeTag(tag byte) {
+	kh.buf[0] = tag
+	kh.h.Write(kh.buf[:1])
+}
+
+func (kh *keyHasher) writeUint(tag byte, n uint64) {
+	kh.buf[0] = tag
+	binary.LittleEndian.PutUint64(kh.buf[1:9], n)
+	kh.h.Write(kh.buf[:9])
+}
+
+func (kh *keyHasher) writeString(s string) {
+	kh.writeUint(tagString, uint64(len(s)))
+	for len(s) > 0 {
+		n := copy(kh.buf[:], s)
+		kh.h.Write(kh.buf[:n])
+		s = s[n:]
+	}
+}
+
+func (kh *keyHasher) write(v reflect.Value) {
+	// Values of named and struct types also hash their type, so that time.Duration(5)
+	// differs from 5 and struct{ A int } from struct{ B int }
+	if v.IsValid() && (v.Type().PkgPath() != "" || v.Kind() == reflect.Struct) {
+		kh.writeTag(tagType)
+		kh.writeString(v.Type().String())
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		kh.writeTag(tagNil)
+	case reflect.Bool:
+		var b uint64
+		if v.Bool() {
+			b = 1
+		}
+		kh.writeUint(tagBool, b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kh.writeUint(tagInt, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		kh.writeUint(tagUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		kh.writeUint(tagFloat, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		kh.writeUint(tagComplex, math.Float64bits(real(c)))
+		kh.writeUint(tagComplex, math.Float64bits(imag(c)))
+	case reflect.String:
+		kh.writeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			kh.writeUint(tagBytes, uint64(v.Len()))
+			kh.h.Write(v.Bytes())
+			return
+		}
+		kh.writeUint(tagList, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			kh.write(v.Index(i))
+		}
+	case reflect.Map:
+		// Hash every entry on its own and sum the digests so that the
+		// result does not depend on the map iteration order.
+		var lo, hi uint64
+		iter := v.MapRange()
+		for iter.Next() {
+			sub := keyHasher{h: fnv.New128a(), visited: kh.visited}
+			sub.write(iter.Key())
+			sub.write(iter.Value())
+			sum := sub.h.Sum(sub.buf[:0])
+			lo += binary.LittleEndian.Uint64(sum[:8])
+			hi += binary.LittleEndian.Uint64(sum[8:16])
+		}
+		kh.writeUint(tagMap, uint64(v.Len()))
+		kh.writeUint(tagMap, lo)
+		kh.writeUint(tagMap, hi)
+	case reflect.Struct:
+		kh.writeUint(tagStruct, uint64(v.NumField()))
+		for i := 0; i < v.NumField(); i++ {
+			kh.write(v.Field(i))
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			kh.writeTag(tagNil)
+			return
+		}
+		// Follow pointers to their contents, guarding against cycles
+		if kh.visited == nil {
+			kh.visited = make(map[uintptr]bool)
+		}
+		if kh.visited[v.Pointer()] {
+			kh.writeUint(tagPointer, uint64(v.Pointer()))
+			return
+		}
+		kh.visited[v.Pointer()] = true
+		kh.writeTag(tagPointer)
+		kh.write(v.Elem())
+		delete(kh.visited, v.Pointer())
+	case reflect.Interface:
+		kh.write(v.Elem())
+	default:
+		// Channels, functions and unsafe pointers only have an identity
+		kh.writeUint(tagOpaque, uint64(v.Pointer()))
+	}
+}
+
+// KeyError is returned when no cache key can be built for the arguments of a call.
+type KeyError struct {
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return "cached: cannot build key: " + e.Err.Error()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// JSONKey builds a key from the canonical JSON encoding of the arguments. Map keys
+// are sorted by encoding/json, so maps with the same contents give the same key
+// whatever their iteration order. Arguments that cannot be encoded give an error.
+func JSONKey(args ...interface{}) (string, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
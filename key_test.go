@@ -0,0 +1,580 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Streaming hash keys are stable and distinguish different arguments
+func TestHashKey(t *testing.T) {
+	m1 := map[string]int{"a": 1, "b": 2, "c": 3}
+	m2 := map[string]int{"c": 3, "b": 2, "a": 1}
+
+	if HashKey(m1, []int{1, 2}) != HashKey(m2, []int{1, 2}) {
+		t.Errorf("Expected equal maps to produce the same key")
+	}
+
+	if HashKey(1, 2) == HashKey([]int{1, 2}) {
+		t.Errorf("Expected different argument shapes to produce different keys")
+	}
+
+	if HashKey("ab", "c") == HashKey("a", "bc") {
+		t.Errorf("Expected string boundaries to be part of the key")
+	}
+
+	if HashKey(struct{ A int }{1}) == HashKey(struct{ B int }{1}) {
+		t.Errorf("Expected structs with different fields to produce different keys")
+	}
+
+	if HashKey(time.Duration(5)) == HashKey(5) {
+		t.Errorf("Expected named types to produce different keys than their underlying types")
+	}
+}
+
+// Test: Cache uses the configured key function
+func TestCachedFunctionHashKey(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithKeyFunc(HashKey))
+
+	var calls int
+
+	// Define a simple function to be cached
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return len(args[0].([]int))
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	big := make([]int, 10000)
+	cachedFunc(big)
+	cachedFunc(big)
+
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+
+	if _, ok := fc.cache[HashKey(big)]; !ok {
+		t.Errorf("Expected entry to be stored under the hashed key")
+	}
+}
+
+// Benchmark: fmt based key on a large slice argument
+func BenchmarkKeySprintfLargeSlice(b *testing.B) {
+	big := make([]int, 100000)
+	args := []interface{}{big}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprintf("%v", args)
+	}
+}
+
+// Benchmark: streaming hash key on a large slice argument
+func BenchmarkKeyHashLargeSlice(b *testing.B) {
+	big := make([]int, 100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = HashKey(big)
+	}
+}
+
+// Test: Struct arguments are keyed on their exported field values
+func TestDefaultKeyStruct(t *testing.T) {
+	type query struct {
+		Name   string
+		Limit  *int
+		cursor int
+	}
+
+	limit1, limit2 := 10, 10
+	q1 := query{Name: "a", Limit: &limit1, cursor: 1}
+	q2 := &query{Name: "a", Limit: &limit2, cursor: 2}
+
+	if DefaultKey(q1) != DefaultKey(q2) {
+		t.Errorf("Expected equal exported fields to produce the same key: %v != %v", DefaultKey(q1), DefaultKey(q2))
+	}
+
+	limit2 = 20
+	if DefaultKey(q1) == DefaultKey(q2) {
+		t.Errorf("Expected different pointed-to values to produce different keys")
+	}
+
+	if DefaultKey(1, 2) != fmt.Sprintf("%v", []interface{}{1, 2}) {
+		t.Errorf("Expected plain arguments to keep the %%v key")
+	}
+}
+
+// Test: Structs with only unexported fields, like time.Time, keep distinct keys
+func TestDefaultKeyTime(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if DefaultKey(t1) == DefaultKey(t2) {
+		t.Errorf("Expected different times to produce different keys, both got %v", DefaultKey(t1))
+	}
+
+	type event struct {
+		Name string
+		At   time.Time
+	}
+	if DefaultKey(event{"a", t1}) == DefaultKey(event{"a", t2}) {
+		t.Errorf("Expected structs differing in a time field to produce different keys, both got %v", DefaultKey(event{"a", t1}))
+	}
+
+	type opaque struct {
+		n int
+	}
+	if DefaultKey(opaque{1}) == DefaultKey(opaque{2}) {
+		t.Errorf("Expected structs without exported fields to be told apart, both got %v", DefaultKey(opaque{1}))
+	}
+	if TypedKey(t1) == TypedKey(t2) || FoldTail(t1) == FoldTail(t2) {
+		t.Errorf("Expected keys built on DefaultKey to tell times apart")
+	}
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	year := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0].(time.Time).Year()
+	})
+	year(t1)
+	if result := year(t2); result != 2021 {
+		t.Errorf("Expected a different time not to hit, got %v", result)
+	}
+}
+
+// userID implements CacheKeyer
+type userID struct {
+	id int
+}
+
+func (u userID) CacheKey() string {
+	return fmt.Sprintf("user-%d", u.id)
+}
+
+// Test: Arguments implementing CacheKeyer provide their own key
+func TestDefaultKeyCacheKeyer(t *testing.T) {
+	if key := DefaultKey(userID{7}, "x"); key != "[user-7 x]" {
+		t.Errorf("Expected CacheKey to be used, got %v", key)
+	}
+}
+
+// slowKey is a key function spending some time on every key
+func slowKey(args ...interface{}) string {
+	time.Sleep(100 * time.Microsecond)
+	return fmt.Sprintf("%v", args)
+}
+
+// Benchmark: cached function with a slow key function and distinct keys
+func BenchmarkSlowKeyFunc(b *testing.B) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithKeyFunc(slowKey))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	for i := 0; i < b.N; i++ {
+		cachedFunc(i)
+	}
+}
+
+// Benchmark: slow key functions run in parallel rather than under the cache lock
+func BenchmarkSlowKeyFuncParallel(b *testing.B) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithKeyFunc(slowKey))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cachedFunc(atomic.AddInt64(&n, 1))
+		}
+	})
+}
+
+// Test: Calls with a function argument are never cached
+func TestCachedFunctionBypassesFuncArguments(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithBypassTypes(reflect.TypeOf(time.Time{})))
+
+	var calls int
+
+	// Define a function taking a callback
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return calls
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	callback := func() {}
+	cachedFunc(callback)
+	cachedFunc(callback)
+	cachedFunc(time.Time{})
+	cachedFunc(time.Time{})
+
+	if calls != 4 {
+		t.Errorf("Expected function to be invoked on every call, but it was called %d times", calls)
+	}
+	if len(fc.cache) != 0 {
+		t.Errorf("Expected nothing to be cached, got %v", fc.cache)
+	}
+}
+
+// Test: JSON keys are independent of map ordering and reject unencodable arguments
+func TestCachedFunctionJSONKeys(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithJSONKeys())
+
+	var calls int
+
+	f := func(args ...interface{}) (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	cachedFunc := fc.WrapE(f)
+
+	m1 := map[string]int{"a": 1, "b": 2, "c": 3}
+	m2 := map[string]int{"c": 3, "b": 2, "a": 1}
+	k1, err1 := JSONKey(m1)
+	k2, err2 := JSONKey(m2)
+	if err1 != nil || err2 != nil || k1 != k2 {
+		t.Errorf("Expected equal maps to produce the same key, got %q, %q", k1, k2)
+	}
+	if k1 != `[{"a":1,"b":2,"c":3}]` {
+		t.Errorf("Expected a readable JSON key, got %q", k1)
+	}
+
+	cachedFunc(m1)
+	cachedFunc(m2)
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+	if _, found := fc.cache[k1]; !found {
+		t.Errorf("Expected the result to be stored under %q, got %v", k1, fc.cache)
+	}
+
+	// A channel nested in a map is not bypassed but cannot be encoded either
+	_, err := cachedFunc(map[string]interface{}{"ch": make(chan int)})
+	var kerr *KeyError
+	if !errors.As(err, &kerr) {
+		t.Errorf("Expected a key error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the function not to be called on a key error, but it was called %d times", calls)
+	}
+}
+
+// Test: Long keys are replaced by a bounded hash which is still unique per input
+func TestCachedFunctionMaxKeyLen(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxKeyLen(100))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return len(args[0].(string))
+	})
+
+	long := strings.Repeat("x", 10000)
+	cachedFunc(long)
+	cachedFunc(long)
+	cachedFunc(long + "y")
+	cachedFunc("short")
+
+	if calls != 3 {
+		t.Errorf("Expected function to be called 3 times, but it was called %d times", calls)
+	}
+	if len(fc.cache) != 3 {
+		t.Errorf("Expected 3 distinct entries, got %d", len(fc.cache))
+	}
+	for key := range fc.cache {
+		if len(key) > 100 {
+			t.Errorf("Expected keys of at most 100 bytes, got %d", len(key))
+		}
+	}
+	if _, found := fc.cache[fmt.Sprintf("%v", []interface{}{"short"})]; !found {
+		t.Errorf("Expected short keys to be kept as is")
+	}
+}
+
+// Test: Typed keys separate calls which format the same
+func TestCachedFunctionTypedKeys(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTypedKeys())
+
+	// The colliding pair formats the same with %v
+	if fmt.Sprintf("%v", []interface{}{1, 2}) != fmt.Sprintf("%v", []interface{}{"1 2"}) {
+		t.Fatalf("Expected the plain keys to collide")
+	}
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return len(args)
+	})
+
+	if result := cachedFunc(1, 2); result != 2 {
+		t.Errorf("Expected 2 arguments, got %v", result)
+	}
+	if result := cachedFunc("1 2"); result != 1 {
+		t.Errorf("Expected 1 argument, got %v", result)
+	}
+	if result := cachedFunc("1", "2"); result != 2 || calls != 3 {
+		t.Errorf("Expected strings to be keyed apart from ints, got %v after %d calls", result, calls)
+	}
+	if len(fc.cache) != 3 {
+		t.Errorf("Expected 3 distinct entries, got %v", fc.cache)
+	}
+}
+
+// Test: Normalized string arguments share an entry
+func TestCachedFunctionStringNormalizer(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithStringNormalizer(strings.ToLower))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	})
+
+	if result := cachedFunc("Foo", 1); result != "Foo" {
+		t.Errorf("Expected the function to get the argument as passed, got %v", result)
+	}
+	cachedFunc("foo", 1)
+	cachedFunc("FOO", 1)
+	if calls != 1 {
+		t.Errorf("Expected differently cased strings to hit, function was called %d times", calls)
+	}
+	if _, found := fc.cache[fmt.Sprintf("%v", []interface{}{"foo", 1})]; !found {
+		t.Errorf("Expected the normalized key, got %v", fc.cache)
+	}
+}
+
+// Test: Transformed arguments are used for the key and reach the function
+func TestCachedFunctionArgTransform(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var transforms int32
+	fc := NewFunctionCache(ctx, WithArgTransform(func(args []interface{}) []interface{} {
+		atomic.AddInt32(&transforms, 1)
+		out := make([]interface{}, len(args))
+		for i, arg := range args {
+			if s, ok := arg.(string); ok {
+				arg = strings.ToLower(strings.TrimSpace(s))
+			}
+			out[i] = arg
+		}
+		return out
+	}))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	})
+
+	if result := cachedFunc(" Foo "); result != "foo" {
+		t.Errorf("Expected the function to get the transformed argument, got %q", result)
+	}
+	if result := cachedFunc("FOO"); result != "foo" || calls != 1 {
+		t.Errorf("Expected transformed arguments to share an entry, got %q after %d calls", result, calls)
+	}
+	if transforms != 2 {
+		t.Errorf("Expected one transform per call, got %d", transforms)
+	}
+
+	fc.Delete("Foo")
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected Delete to use the transformed key, got %d entries", size)
+	}
+}
+
+// Test: Calls differing only in a non-key argument share one entry
+func TestCachedFunctionKeyArgs(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithKeyArgs(0))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return fmt.Sprint(args...)
+	})
+
+	if result := cachedFunc("id", true); result != "idtrue" {
+		t.Errorf("Expected the function to get all arguments, got %v", result)
+	}
+	cachedFunc("id", false)
+	cachedFunc("id", func() {})
+	if calls != 1 {
+		t.Errorf("Expected calls differing in a non-key argument to hit, function was called %d times", calls)
+	}
+	if _, found := fc.cache[fmt.Sprintf("%v", []interface{}{"id"})]; !found {
+		t.Errorf("Expected the entry to be keyed on the id only, got %v", fc.cache)
+	}
+}
+
+// Test: Calls sharing an idempotency key get the first response whatever their payload
+func TestCachedFunctionIdempotencyKey(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithIdempotencyKey(0))
+
+	var calls int
+	charge := fc.WrapE(func(args ...interface{}) (interface{}, error) {
+		calls++
+		return fmt.Sprintf("charged %v", args[1]), nil
+	})
+
+	if result, _ := charge("key-1", 100); result != "charged 100" {
+		t.Errorf("Expected the first call to get its payload, got %v", result)
+	}
+	if result, _ := charge("key-1", 200); result != "charged 100" || calls != 1 {
+		t.Errorf("Expected a repeated key to get the first response, got %v after %d calls", result, calls)
+	}
+	if result, _ := charge("key-2", 200); result != "charged 200" || calls != 2 {
+		t.Errorf("Expected a new key to be computed, got %v after %d calls", result, calls)
+	}
+
+	// Calls without a key are never deduplicated
+	charge("", 300)
+	charge("", 300)
+	if calls != 4 {
+		t.Errorf("Expected calls without a key to bypass the cache, function was called %d times", calls)
+	}
+}
+
+// Test: Semantically equal but textually different arguments share an entry
+func TestCachedFunctionCanonicalizer(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithCanonicalizer(Canonical))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	})
+
+	berlin := time.FixedZone("CEST", 2*60*60)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cachedFunc(at)
+	cachedFunc(at.In(berlin))
+	if calls != 1 {
+		t.Errorf("Expected equal instants in different zones to share an entry, function was called %d times", calls)
+	}
+	cachedFunc(at.Add(time.Second))
+	if calls != 2 {
+		t.Errorf("Expected different instants not to share an entry, function was called %d times", calls)
+	}
+	cachedFunc(0.0)
+	cachedFunc(math.Copysign(0, -1))
+	if calls != 3 {
+		t.Errorf("Expected both zeros to share an entry, function was called %d times", calls)
+	}
+	if result := cachedFunc(at.In(berlin), 1.0); result != at.In(berlin) || calls != 4 {
+		t.Errorf("Expected the function to get the argument as passed, got %v after %d calls", result, calls)
+	}
+
+	// Without the canonicalizer the zones print differently and get their own entries
+	plain := NewFunctionCache(ctx)
+	var plainCalls int
+	plainFunc := plain.Wrap(func(args ...interface{}) interface{} {
+		plainCalls++
+		return args[0]
+	})
+	plainFunc(at)
+	plainFunc(at.In(berlin))
+	if plainCalls != 2 {
+		t.Errorf("Expected the zones to be keyed apart without the canonicalizer, function was called %d times", plainCalls)
+	}
+}
+
+// Test: Variadic tails are folded into stable, distinct and bounded keys
+func TestCachedFunctionFoldedTail(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithFoldedTail(1), WithMaxSize(10000))
+
+	var calls int
+	sum := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		total := 0
+		for _, arg := range args {
+			total += arg.(int)
+		}
+		return total
+	})
+
+	keys := make(map[string]bool)
+	for n := 0; n < 500; n++ {
+		tail := make([]interface{}, 0, n+1)
+		tail = append(tail, 1)
+		for i := 0; i < n; i++ {
+			tail = append(tail, i)
+		}
+		sum(tail...)
+		key, _ := fc.key(tail)
+		if again, _ := fc.key(tail); again != key {
+			t.Fatalf("Expected a stable key, got %v and %v", key, again)
+		}
+		if len(key) > 100 {
+			t.Fatalf("Expected a bounded key for a tail of %d, got %d bytes", n, len(key))
+		}
+		keys[key] = true
+	}
+	if len(keys) != 500 || calls != 500 {
+		t.Errorf("Expected 500 distinct keys and computations, got %d, %d", len(keys), calls)
+	}
+
+	// Tails printing alike still differ
+	if FoldTail(1, 2) == FoldTail("1 2") || FoldTail(1, 2) == FoldTail([]int{1, 2}) {
+		t.Errorf("Expected tails of different types and counts to fold differently")
+	}
+	if sum(1, 5, 5); calls != 501 {
+		t.Errorf("Expected a new tail to be computed, function was called %d times", calls)
+	}
+	if sum(1, 5, 5); calls != 501 {
+		t.Errorf("Expected a repeated tail to hit, function was called %d times", calls)
+	}
+}
@@ -0,0 +1,99 @@
+package cached
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyBuckets is the number of histogram buckets, bucket i counting durations of
+// up to 2^i microseconds and the last one everything longer.
+const latencyBuckets = 32
+
+// Latency summarizes the durations of the computations run by a cache. Percentiles
+// are the upper bounds of their histogram buckets, capped at Max.
+type Latency struct {
+	Count int64         `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+}
+
+// histogram records durations in exponential buckets.
+type histogram struct {
+	m       sync.Mutex
+	buckets [latencyBuckets]int64
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+// record adds a duration to the histogram.
+func (h *histogram) record(d time.Duration) {
+	i := 0
+	for i < latencyBuckets-1 && d > bucketBound(i) {
+		i++
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.buckets[i]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// summary returns the statistics of the recorded durations.
+func (h *histogram) summary() Latency {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.count == 0 {
+		return Latency{}
+	}
+	return Latency{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		Mean:  h.sum / time.Duration(h.count),
+		P50:   h.percentile(0.50),
+		P90:   h.percentile(0.90),
+		P99:   h.percentile(0.99),
+	}
+}
+
+// percentile returns the upper bound of the bucket holding the p-th fraction of the
+// durations. It must be called with h.m held.
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := int64(p*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := int64(0)
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			if bound := bucketBound(i); i < latencyBuckets-1 && bound < h.max {
+				return bound
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// bucketBound returns the upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	return time.Microsecond << i
+}
+
+// Latency returns the duration statistics of the computations run by this cache.
+func (fc *FunctionCache) Latency() Latency {
+	return fc.latency.summary()
+}
@@ -0,0 +1,505 @@
+package cached
+
+import (
+	"log"
+	"reflect"
+	"time"
+)
+
+// Option configures a FunctionCache created with NewFunctionCache.
+type Option func(*FunctionCache)
+
+// WithKeyFunc replaces the default fmt-based key builder with f. The key is always
+// computed outside of the cache locks, so an expensive f does not serialize callers.
+func WithKeyFunc(f func(args ...interface{}) string) Option {
+	return func(fc *FunctionCache) {
+		fc.keyFunc = f
+	}
+}
+
+// WithKeyArgs only uses the arguments at the given positions for the key, e.g. the id
+// but not a debug flag, while the function still gets all arguments. Arguments at
+// other positions do not make a call bypass the cache either.
+func WithKeyArgs(indices ...int) Option {
+	return func(fc *FunctionCache) {
+		fc.keyArgs = append([]int{}, indices...)
+	}
+}
+
+// WithIdempotencyKey keys calls on the argument at index alone, a client supplied
+// idempotency key, so that repeated calls with the same key get the first response
+// whatever the rest of their payload, which only the first call passes to the
+// function. Failed calls are not cached and can be retried. Calls without a key, or
+// with a nil or empty one, bypass the cache.
+func WithIdempotencyKey(index int) Option {
+	return func(fc *FunctionCache) {
+		fc.keyArgs = []int{index}
+		fc.idempotent = true
+	}
+}
+
+// WithStringNormalizer applies f to string arguments before the key is built, by the
+// key function too, e.g. strings.ToLower so that "Foo" and "foo" share an entry. The
+// wrapped function still gets the arguments as passed.
+func WithStringNormalizer(f func(string) string) Option {
+	return func(fc *FunctionCache) {
+		fc.normalize = f
+	}
+}
+
+// WithCanonicalizer applies f to every argument before the key is built, by the key
+// function too, mapping semantically equal arguments to the same value so that they
+// share an entry, e.g. Canonical for floats and times. Like WithStringNormalizer it
+// only affects the key and runs after it.
+func WithCanonicalizer(f func(arg interface{}) interface{}) Option {
+	return func(fc *FunctionCache) {
+		fc.canonical = f
+	}
+}
+
+// WithArgTransform applies f to the arguments of every call, which are then used
+// both for the key and to call the wrapped function, unlike WithStringNormalizer
+// which only affects the key. The same transform applies to the arguments of Delete,
+// Forget, Pin and the other methods taking call arguments.
+func WithArgTransform(f func(args []interface{}) []interface{}) Option {
+	return func(fc *FunctionCache) {
+		fc.transform = f
+	}
+}
+
+// WithFoldedTail folds the arguments from position from on into one fixed length
+// digest in the key, see FoldTail, so that functions like f(base int, extras ...int)
+// get bounded keys which still tell different tails apart. It applies after
+// WithKeyArgs selected the key arguments, and the function still gets all arguments.
+func WithFoldedTail(from int) Option {
+	return func(fc *FunctionCache) {
+		fc.foldTail = true
+		fc.foldFrom = from
+	}
+}
+
+// WithJSONKeys keys entries on the canonical JSON encoding of the arguments, see
+// JSONKey. Calls whose arguments cannot be encoded are not cached: WrapE returns a
+// *KeyError and plain wrappers log it and call the function directly.
+func WithJSONKeys() Option {
+	return func(fc *FunctionCache) {
+		fc.jsonKeys = true
+	}
+}
+
+// WithTypedKeys keys entries with TypedKey, so that calls with a different number or
+// types of arguments never share an entry even when they format the same.
+func WithTypedKeys() Option {
+	return func(fc *FunctionCache) {
+		fc.typedKeys = true
+	}
+}
+
+// WithMaxKeyLen replaces keys longer than n bytes with the hex SHA-256 of the full key,
+// 64 bytes long, so that very long arguments do not bloat the cache maps.
+func WithMaxKeyLen(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.maxKeyLen = n
+	}
+}
+
+// WithAdmissionThreshold only stores a result once its key has been requested n times,
+// keeping one-off computations out of the cache.
+func WithAdmissionThreshold(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.admission = n
+	}
+}
+
+// WithTinyLFU adds a TinyLFU admission filter in front of the eviction policy. It
+// estimates how often keys were requested recently in a count-min sketch and, once
+// the cache is full, only stores a new result if its key was requested more often
+// than the entry that would be evicted for it, keeping one-hit wonders from pushing
+// out popular entries on skewed workloads. The sketch is sized for the capacity set
+// when the cache is created.
+func WithTinyLFU() Option {
+	return func(fc *FunctionCache) {
+		fc.tinyLFU = true
+	}
+}
+
+// WithEvictionPolicy selects the policy used to make room when the cache is full.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(fc *FunctionCache) {
+		fc.policy = p
+	}
+}
+
+// WithMaxSize sets the maximum number of entries of this cache instead of MaxCacheSize.
+func WithMaxSize(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.maxSize = n
+	}
+}
+
+// WithTTL sets the expiry time of entries of this cache instead of CacheExpiryTime.
+func WithTTL(d time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.ttl = d
+	}
+}
+
+// WithGroup makes the cache deduplicate in-flight computations through g,
+// which may be shared with other caches.
+func WithGroup(g *Group) Option {
+	return func(fc *FunctionCache) {
+		fc.group = g
+	}
+}
+
+// WithComputeGuard captures a validity token with guard before each computation and
+// checks it again afterwards. If the token changed, for example because the function
+// read external versioned state that was updated meanwhile, the result is returned but
+// not cached. Tokens are compared with == and must be comparable.
+func WithComputeGuard(guard func() (token interface{})) Option {
+	return func(fc *FunctionCache) {
+		fc.guard = guard
+	}
+}
+
+// WithServeStaleOnError keeps expired values for one more expiry time and, when the
+// recomputation of such an entry in a WrapE function fails, returns the stale value
+// instead of the error.
+func WithServeStaleOnError() Option {
+	return func(fc *FunctionCache) {
+		fc.keepStale = true
+	}
+}
+
+// WithMinRecomputeInterval suppresses recomputing a key for d after it was computed,
+// serving the last computed value instead, even when its entry expired meanwhile.
+func WithMinRecomputeInterval(d time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.interval = d
+	}
+}
+
+// WithMaxWaiters limits the number of callers waiting for the same in-flight
+// computation to n. Callers beyond the limit get ErrTooManyWaiters from WrapE
+// functions, while plain wrapped functions compute the result independently.
+func WithMaxWaiters(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.waiters = n
+	}
+}
+
+// WithRecursionCheck selects whether calls of a wrapped function for arguments it is
+// already computing on the same goroutine, which would wait for themselves forever,
+// are detected. It is on by default: such calls fail with ErrRecursiveCall from WrapE
+// functions while plain wrapped functions compute the result directly. Detection
+// identifies the goroutine of every caller missing the cache, which costs a few
+// microseconds per miss, so caches of very cheap functions may turn it off. It is
+// always on in DEBUG mode.
+func WithRecursionCheck(check bool) Option {
+	return func(fc *FunctionCache) {
+		fc.recursion = check
+	}
+}
+
+// WithLazyExpiry disables the expiration goroutine. Expired entries are removed when
+// they are read or when ExpireNow is called, which gives tests full control over timing.
+func WithLazyExpiry() Option {
+	return func(fc *FunctionCache) {
+		fc.lazy = true
+	}
+}
+
+// WithScheduledFlush clears the cache at fixed wall-clock boundaries aligned to
+// interval, regardless of the expiry time of the entries. For example time.Hour
+// flushes at the top of every hour (UTC aligned) to follow an upstream refresh schedule.
+func WithScheduledFlush(interval time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.flush = interval
+	}
+}
+
+// WithValueCodec transforms values with encode before they are stored and with decode
+// when they are read, e.g. to compress large values (see NewGzipCodec). Values that
+// fail to encode are returned but not cached, the byte accounting uses the encoded size.
+func WithValueCodec(encode, decode func(interface{}) (interface{}, error)) Option {
+	return func(fc *FunctionCache) {
+		fc.encoder = encode
+		fc.decoder = decode
+	}
+}
+
+// WithSizeFunc replaces DefaultSize as the estimate of the size in bytes of stored values.
+func WithSizeFunc(f func(interface{}) int) Option {
+	return func(fc *FunctionCache) {
+		fc.sizeFunc = f
+	}
+}
+
+// WithEvictionBatch evicts n entries at once when the cache is full instead of one
+// per insert, amortizing the eviction work for persistently full caches.
+func WithEvictionBatch(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.batch = n
+	}
+}
+
+// WithOnEvict registers a hook called with every value leaving the cache through
+// eviction, expiry, Delete or Clear. Hooks run outside of all internal locks, so they
+// may call back into the same cache, e.g. Set a record of the value, even if that
+// evicts another entry and calls the hook again. The hook gets values as returned
+// by the function or passed to Set, decoded if a value codec is set, and weakly held
+// values only unless they were collected. Values implementing io.Closer are closed
+// after the hook whether a hook is set or not.
+func WithOnEvict(f func(key string, value interface{})) Option {
+	return func(fc *FunctionCache) {
+		fc.onEvict = f
+	}
+}
+
+// WithBypassTypes makes calls with an argument of one of the given types bypass the
+// cache. Functions, channels and unsafe pointers always bypass it.
+func WithBypassTypes(types ...reflect.Type) Option {
+	return func(fc *FunctionCache) {
+		if fc.bypass == nil {
+			fc.bypass = make(map[reflect.Type]bool)
+		}
+		for _, t := range types {
+			fc.bypass[t] = true
+		}
+	}
+}
+
+// WithDefaultOnMiss makes plain wrapped functions return the value of f instead of
+// nil when waiting for another caller's computation yielded no value.
+func WithDefaultOnMiss(f func() interface{}) Option {
+	return func(fc *FunctionCache) {
+		fc.onMiss = f
+	}
+}
+
+// WithRecomputeRateLimit caps the computations of all keys to rate per second with
+// bursts of up to burst computations, using a token bucket. Computations beyond the
+// limit wait for a token unless WithRateLimitReject is given.
+func WithRecomputeRateLimit(rate float64, burst int) Option {
+	return func(fc *FunctionCache) {
+		fc.limiter = newTokenBucket(rate, burst)
+	}
+}
+
+// WithRateLimitReject makes computations beyond the recompute rate limit fail with
+// ErrRateLimited instead of waiting. Plain wrapped functions return their default value.
+func WithRateLimitReject() Option {
+	return func(fc *FunctionCache) {
+		fc.rejectLimited = true
+	}
+}
+
+// WithInvalidateOn removes all entries whose key matches an event received on ch,
+// as reported by match, so that the next call recomputes them. The cache stops
+// listening when ch is closed or the cache is closed.
+func WithInvalidateOn(ch <-chan string, match func(key, event string) bool) Option {
+	return func(fc *FunctionCache) {
+		fc.invalidate = ch
+		fc.match = match
+	}
+}
+
+// WithComputeTimeout gives up on computations taking longer than d. The leader and its
+// waiters get an error wrapping ErrComputeTimeout, nothing is cached and the key is
+// free for the next call, while the timed out computation finishes detached.
+func WithComputeTimeout(d time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.timeout = d
+	}
+}
+
+// WithFirstMissFallback serves the value of fb on a miss instead of blocking, while the
+// real value is computed in the background and served by later calls once stored.
+func WithFirstMissFallback(fb func(args ...interface{}) interface{}) Option {
+	return func(fc *FunctionCache) {
+		fc.fallback = fb
+	}
+}
+
+// WithWeakValues holds values through weak references, so that the GC can reclaim
+// them and a collected value is computed again like a miss. New entries are also held
+// strongly until the first expiration sweep at least CacheExpirySleepTime after they
+// were stored, with lazy expiry until ExpireNow, and then survive only until the next
+// GC cycle, like the items of a sync.Pool, trading hit rate for memory. It requires Go
+// 1.24, older versions keep holding values strongly.
+func WithWeakValues() Option {
+	return func(fc *FunctionCache) {
+		if !weakSupported {
+			log.Printf("Warning: weak values need Go 1.24, holding values strongly\n")
+		}
+		fc.weakValues = true
+	}
+}
+
+// WithPartition splits the cache into partitions, e.g. one per tenant, named by f
+// from the arguments of every call. The maximum size applies to every partition on
+// its own and eviction only removes entries of the partition that is full, so that
+// one partition cannot push out the entries of another.
+func WithPartition(f func(args ...interface{}) string) Option {
+	return func(fc *FunctionCache) {
+		fc.partition = f
+	}
+}
+
+// WithEqual sets the function comparing values in CompareAndDelete and CompareAndSwap,
+// needed for values which are not comparable with ==, such as slices.
+func WithEqual(f func(a, b interface{}) bool) Option {
+	return func(fc *FunctionCache) {
+		fc.equal = f
+	}
+}
+
+// WithMaxNegatives gives the negative results cached by a TwoLevel cache using this
+// cache as L1 their own capacity of n entries, so that a flood of lookups of missing
+// values evicts older negatives instead of positive entries. Without it negatives
+// share the maximum size with positive entries.
+func WithMaxNegatives(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.maxNegatives = n
+	}
+}
+
+// WithOnCompute calls f with the key, value and duration of every successful
+// computation, but not for hits or callers served by another caller's computation.
+// It runs outside the cache lock once the waiters of the computation have their result.
+func WithOnCompute(f func(key string, value interface{}, dur time.Duration)) Option {
+	return func(fc *FunctionCache) {
+		fc.onCompute = f
+	}
+}
+
+// WithBackgroundWorkers runs background computations, such as those started by
+// WithFirstMissFallback, on n workers instead of a goroutine each. Up to queue
+// computations wait for a worker, further ones are dropped, so with a queue of zero
+// work is dropped whenever all workers are busy.
+func WithBackgroundWorkers(n, queue int) Option {
+	return func(fc *FunctionCache) {
+		fc.workers = n
+		fc.jobs = make(chan func(), queue)
+	}
+}
+
+// WithoutDedup turns off in-flight deduplication: concurrent callers missing the same
+// key all compute it and the last one to finish leaves its result cached. For very
+// cheap functions this is faster than coordinating the callers.
+func WithoutDedup() Option {
+	return func(fc *FunctionCache) {
+		fc.noDedup = true
+	}
+}
+
+// WithAudit delivers an event for every entry stored (EventAdd) and removed
+// (EventEvict, EventExpire or EventDelete) to sink, one at a time in the order the
+// changes happened. Unlike Subscribe no event is ever dropped: callers changing the
+// cache wait for the sink, which must not call back into the cache.
+func WithAudit(sink func(Event)) Option {
+	return func(fc *FunctionCache) {
+		fc.audit = sink
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving expired entries while they are recomputed.
+// Each entry is fresh within its expiry time, then stale: it is still returned, and
+// the first reader of a stale entry moves it to refreshing and starts exactly one
+// background recomputation, returning the stale value like every reader after it. The
+// new value makes the entry fresh again, a failed recomputation makes it stale again.
+// Stale entries nobody reads within another expiry time are removed.
+func WithStaleWhileRevalidate() Option {
+	return func(fc *FunctionCache) {
+		fc.states = make(map[string]entryState)
+	}
+}
+
+// WithSentinels makes results equal to one of values, such as "" or -1 returned to
+// mean failure, be returned to the caller and its waiters but not cached. Values are
+// compared with ==, see WithSentinelFunc for values which are not comparable.
+func WithSentinels(values ...interface{}) Option {
+	return WithSentinelFunc(func(result interface{}) bool {
+		for _, v := range values {
+			if result == nil && v == nil || same(result, v) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithSentinelFunc makes results for which isSentinel returns true be returned to the
+// caller and its waiters but not cached.
+func WithSentinelFunc(isSentinel func(result interface{}) bool) Option {
+	return func(fc *FunctionCache) {
+		fc.sentinel = isSentinel
+	}
+}
+
+// WithMinResidency spares entries stored less than d ago from eviction while older
+// entries can be evicted instead, so that a new entry, e.g. one never used yet under
+// LFU, is not evicted right away by the next insert. If all candidates are younger
+// than d, they are evicted anyway.
+func WithMinResidency(d time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.minResidency = d
+	}
+}
+
+// WithMaxValueBytes makes results whose size, as measured by the size function, is
+// over n be returned to the caller and its waiters but not cached, e.g. the result of
+// a runaway query. Skipped results are logged and counted in Stats.Oversized.
+func WithMaxValueBytes(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.maxValueBytes = n
+	}
+}
+
+// WithSetBumpsRecency selects whether Set, Swap and CompareAndSwap count as a use of
+// the entry for eviction. By default they do, placing the entry at the most recently
+// used position like an insert. With bump set to false, priming the cache does not
+// distort eviction: a replaced entry keeps its position and a new entry is placed
+// first in line for eviction until it is used.
+func WithSetBumpsRecency(bump bool) Option {
+	return func(fc *FunctionCache) {
+		fc.setKeepsOrder = !bump
+	}
+}
+
+// WithSetWakesWaiters makes Set and Swap for arguments being computed hand the stored
+// value to the callers waiting for that computation, which return it right away
+// instead of waiting for the leader. The leader still finishes and its caller gets
+// the computed result. With supersede set, the Set value also takes precedence over
+// that result, which is then not stored, as the computation started before the Set;
+// otherwise the result replaces the Set value once computed, as it does by default.
+func WithSetWakesWaiters(supersede bool) Option {
+	return func(fc *FunctionCache) {
+		fc.setWakes = true
+		fc.setSupersedes = supersede
+	}
+}
+
+// WithExpiryWorkers divides the scan of each expiration sweep across n goroutines,
+// for caches too large for one goroutine to check in time. The sweep still holds the
+// cache lock throughout, the workers only check entries in parallel, and expired
+// entries are removed in the same order as with a single worker.
+func WithExpiryWorkers(n int) Option {
+	return func(fc *FunctionCache) {
+		fc.expiryWorkers = n
+	}
+}
+
+// WithWriteBack makes the cache write computed and Set entries back to saver in the
+// background instead of synchronously: entries are marked dirty when stored and the
+// dirty ones are saved every interval, and by Sync and Close, so that a clean
+// shutdown loses no writes. Entries removed before their flush are still saved. An
+// interval of 0 only saves on Sync and Close.
+func WithWriteBack(saver Saver, interval time.Duration) Option {
+	return func(fc *FunctionCache) {
+		fc.saver = saver
+		fc.saveEvery = interval
+		fc.dirty = make(map[string]interface{})
+		fc.saved = make(chan struct{})
+	}
+}
@@ -0,0 +1,450 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Results are only cached once the admission threshold is reached
+func TestCachedFunctionAdmissionThreshold(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithAdmissionThreshold(3))
+
+	// Define a simple function to be cached
+	f := func(args ...interface{}) interface{} {
+		return args[0].(int) + args[1].(int)
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	// Request one key once and another one three times
+	cachedFunc(1, 2)
+	for i := 0; i < 3; i++ {
+		cachedFunc(2, 3)
+	}
+
+	if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{1, 2})]; ok {
+		t.Errorf("Expected key requested once not to be cached")
+	}
+	if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{2, 3})]; !ok {
+		t.Errorf("Expected key requested 3 times to be cached")
+	}
+}
+
+// Test: Results computed while the guard token changed are not cached
+func TestCachedFunctionComputeGuard(t *testing.T) {
+	var version int32
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithComputeGuard(func() interface{} {
+		return atomic.LoadInt32(&version)
+	}))
+
+	// Define a function whose external state changes mid-compute on the first call
+	f := func(args ...interface{}) interface{} {
+		if args[0].(int) == 1 {
+			atomic.AddInt32(&version, 1)
+		}
+		return args[0]
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	if result := cachedFunc(1); result != 1 {
+		t.Errorf("Expected result to be returned, got %v", result)
+	}
+	cachedFunc(2)
+
+	if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{1})]; ok {
+		t.Errorf("Expected result computed during a version change not to be cached")
+	}
+	if _, ok := fc.cache[fmt.Sprintf("%v", []interface{}{2})]; !ok {
+		t.Errorf("Expected result computed with a stable version to be cached")
+	}
+}
+
+// Test: A stale value is served when the recomputation fails
+func TestCachedFunctionServeStaleOnError(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(50*time.Millisecond), WithServeStaleOnError())
+
+	var calls int
+
+	// Define a function failing after its first call
+	f := func(args ...interface{}) (interface{}, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("backend down")
+		}
+		return "fresh", nil
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.WrapE(f)
+	cachedFunc(1)
+
+	// Expire the entry
+	time.Sleep(100 * time.Millisecond)
+	fc.lock()
+	fc.sweep()
+	fc.m.Unlock()
+
+	result, err := cachedFunc(1)
+	if err != nil || result != "fresh" {
+		t.Errorf("Expected stale value to be served, got %v, %v", result, err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected function to be recomputed, but it was called %d times", calls)
+	}
+}
+
+// Test: A frequently expiring key is not recomputed more than once per interval
+func TestCachedFunctionMinRecomputeInterval(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(10*time.Millisecond), WithMinRecomputeInterval(200*time.Millisecond))
+
+	var calls int
+
+	// Define a simple function to be cached
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return calls
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	// Force rapid expirations
+	for i := 0; i < 5; i++ {
+		if result := cachedFunc(1); result != 1 {
+			t.Errorf("Expected last value to be served, got %v", result)
+		}
+		time.Sleep(20 * time.Millisecond)
+		fc.lock()
+		fc.sweep()
+		fc.m.Unlock()
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once within the interval, but it was called %d times", calls)
+	}
+
+	// Recompute once the interval passed
+	time.Sleep(200 * time.Millisecond)
+	if result := cachedFunc(1); result != 2 {
+		t.Errorf("Expected recomputation after the interval, got %v", result)
+	}
+}
+
+// Test: Callers beyond the maximum number of waiters do not wait
+func TestCachedFunctionMaxWaiters(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxWaiters(2))
+
+	var calls int32
+
+	// Define a slow function
+	f := func(args ...interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(200 * time.Millisecond)
+		return args[0], nil
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.WrapE(f)
+
+	// Start the leader and let it register before the others
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cachedFunc(1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var rejected int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cachedFunc(1); errors.Is(err, ErrTooManyWaiters) {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rejected != 3 {
+		t.Errorf("Expected 3 callers to be rejected, got %d", rejected)
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+}
+
+// Test: Waiters get the default value when the computation they waited for failed
+func TestCachedFunctionDefaultOnMiss(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithDefaultOnMiss(func() interface{} {
+		return []string{}
+	}))
+
+	// Define a slow function which panics
+	f := func(args ...interface{}) interface{} {
+		time.Sleep(100 * time.Millisecond)
+		panic("backend exploded")
+	}
+
+	// Create a cached version of the function
+	cachedFunc := fc.Wrap(f)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("Expected leader to panic")
+			}
+		}()
+		cachedFunc(1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	result := cachedFunc(1)
+	wg.Wait()
+
+	if values, ok := result.([]string); !ok || values == nil {
+		t.Errorf("Expected default empty slice, got %#v", result)
+	}
+}
+
+// Test: The fallback is served on a miss and the real value once computed
+func TestCachedFunctionFirstMissFallback(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithFirstMissFallback(func(args ...interface{}) interface{} {
+		return "placeholder"
+	}))
+
+	release := make(chan struct{})
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		<-release
+		return "real"
+	})
+
+	if result := cachedFunc(1); result != "placeholder" {
+		t.Errorf("Expected the fallback on first miss, got %v", result)
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for fc.Stats().Size == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if result := cachedFunc(1); result != "real" {
+		t.Errorf("Expected the real value on a subsequent call, got %v", result)
+	}
+}
+
+// Test: The compute callback fires once per actual computation
+func TestCachedFunctionOnCompute(t *testing.T) {
+	var m sync.Mutex
+	var keys []string
+	var durations []time.Duration
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithOnCompute(func(key string, value interface{}, dur time.Duration) {
+		m.Lock()
+		defer m.Unlock()
+		keys = append(keys, key)
+		durations = append(durations, dur)
+	}))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		time.Sleep(20 * time.Millisecond)
+		return args[0]
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cachedFunc(1)
+		}()
+	}
+	wg.Wait()
+	cachedFunc(1)
+	cachedFunc(2)
+
+	m.Lock()
+	defer m.Unlock()
+	if len(keys) != 2 || keys[0] != "[1]" || keys[1] != "[2]" {
+		t.Errorf("Expected one callback per computation, got %v", keys)
+	}
+	for _, d := range durations {
+		if d < 20*time.Millisecond || d > time.Second {
+			t.Errorf("Expected a plausible duration, got %v", d)
+		}
+	}
+}
+
+// Test: Without deduplication concurrent callers compute independently
+func TestCachedFunctionWithoutDedup(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithoutDedup())
+
+	var calls int32
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return args[0]
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cachedFunc(1)
+		}()
+	}
+	wg.Wait()
+	cachedFunc(1)
+
+	if calls != 3 {
+		t.Errorf("Expected every concurrent caller to compute, function was called %d times", calls)
+	}
+}
+
+// benchmarkDedup runs a trivial function missing most of the time under parallelism
+func benchmarkDedup(b *testing.B, opts ...Option) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, append(opts, WithMaxSize(64))...)
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cachedFunc(atomic.AddInt64(&n, 1) % 1024)
+		}
+	})
+}
+
+// Benchmark: Trivial function with in-flight deduplication
+func BenchmarkCachedFunctionDedup(b *testing.B) {
+	benchmarkDedup(b)
+}
+
+// Benchmark: Trivial function without in-flight deduplication
+func BenchmarkCachedFunctionWithoutDedup(b *testing.B) {
+	benchmarkDedup(b, WithoutDedup())
+}
+
+// Test: Sentinel results reach all waiters but are never stored
+func TestCachedFunctionSentinels(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errNotFound := errors.New("not found")
+	fc := NewFunctionCache(ctx, WithSentinels("", -1, errNotFound))
+
+	var calls int32
+	lookup := fc.Wrap(func(args ...interface{}) interface{} {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		switch args[0] {
+		case "missing":
+			return ""
+		case "broken":
+			return errNotFound
+		case "negative":
+			return -1
+		}
+		return args[0]
+	})
+
+	for _, arg := range []string{"missing", "broken", "negative"} {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v := lookup(arg); v == arg {
+					t.Errorf("Expected the sentinel of %v, got %v", arg, v)
+				}
+			}()
+		}
+		wg.Wait()
+		if _, found := fc.EntryInfo(arg); found {
+			t.Errorf("Expected the sentinel of %v not to be cached", arg)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected waiters to share the sentinel, function was called %d times", calls)
+	}
+
+	lookup("found")
+	if _, found := fc.EntryInfo("found"); !found {
+		t.Errorf("Expected other results to be cached")
+	}
+}
+
+// Test: Oversized values are served but not cached
+func TestCachedFunctionMaxValueBytes(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxValueBytes(100))
+
+	var calls int
+	query := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return make([]byte, args[0].(int))
+	})
+
+	for i := 0; i < 2; i++ {
+		if result := query(1000); len(result.([]byte)) != 1000 {
+			t.Errorf("Expected the oversized value to be served, got %d bytes", len(result.([]byte)))
+		}
+	}
+	if _, found := fc.EntryInfo(1000); found || calls != 2 {
+		t.Errorf("Expected the oversized value not to be cached, found %v after %d calls", found, calls)
+	}
+	query(10)
+	if _, found := fc.EntryInfo(10); !found {
+		t.Errorf("Expected a small value to be cached")
+	}
+	if stats := fc.Stats(); stats.Oversized != 2 || stats.Size != 1 {
+		t.Errorf("Expected 2 oversized skips and 1 entry, got %d, %d", stats.Oversized, stats.Size)
+	}
+}
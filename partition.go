@@ -0,0 +1,37 @@
+package cached
+
+import "strings"
+
+// partitionSep separates the partition from the rest of the key. Partition names
+// must not contain it.
+const partitionSep = "\x00"
+
+// partitionOf returns the partition of key, or "" without partitions.
+func (fc *FunctionCache) partitionOf(key string) string {
+	if fc.partition == nil {
+		return ""
+	}
+	part, _, _ := strings.Cut(key, partitionSep)
+	return part
+}
+
+// size returns the number of positive entries in partition part, or in the whole
+// cache without partitions. It must be called with fc.m held.
+func (fc *FunctionCache) size(part string) int {
+	if fc.partition == nil {
+		return len(fc.cache) - len(fc.negs)
+	}
+	return fc.partSizes[part]
+}
+
+// unaccount removes key from the size of its partition. It must be called with fc.m
+// held and key still present.
+func (fc *FunctionCache) unaccount(key string) {
+	if fc.partition == nil {
+		return
+	}
+	part := fc.partitionOf(key)
+	if fc.partSizes[part]--; fc.partSizes[part] <= 0 {
+		delete(fc.partSizes, part)
+	}
+}
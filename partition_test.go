@@ -0,0 +1,38 @@
+package cached
+
+import (
+	"context"
+	"testing"
+)
+
+// Test: Filling one partition does not evict the entries of another
+func TestCachedFunctionPartition(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(2), WithPartition(func(args ...interface{}) string {
+		return args[0].(string)
+	}))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[1]
+	})
+
+	cachedFunc("quiet", 1)
+	cachedFunc("quiet", 2)
+	for i := 0; i < 10; i++ {
+		cachedFunc("noisy", i)
+	}
+
+	if stats := fc.Stats(); stats.Size != 4 || stats.Evictions != 8 {
+		t.Errorf("Expected both partitions to hold 2 entries, got %+v", stats)
+	}
+	calls = 0
+	cachedFunc("quiet", 1)
+	cachedFunc("quiet", 2)
+	if calls != 0 {
+		t.Errorf("Expected the quiet partition to keep its entries, function was called %d times", calls)
+	}
+}
@@ -0,0 +1,79 @@
+package cached
+
+import (
+	"context"
+	"encoding/gob"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotEntry is a cache entry as written to a snapshot file.
+type snapshotEntry struct {
+	Key   string
+	Value interface{}
+	Entry time.Time
+	TTL   time.Duration
+}
+
+// NewPersistentFunctionCache creates a FunctionCache which is loaded from the gob
+// encoded snapshot at path and written back to it on Close. Expired entries are
+// skipped on load, a missing or corrupt snapshot starts an empty cache. Values of
+// types other than the basic ones must be registered with gob.Register.
+func NewPersistentFunctionCache(ctx context.Context, path string, opts ...Option) *FunctionCache {
+	fc := NewFunctionCache(ctx, opts...)
+	fc.path = path
+	if err := fc.load(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Ignoring unreadable cache snapshot: %v, %v\n", path, err)
+	}
+	return fc
+}
+
+// load stores the unexpired entries of the snapshot at path.
+func (fc *FunctionCache) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []snapshotEntry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+
+	fc.lock()
+	defer fc.unlock()
+	for _, e := range entries {
+		fc.restore(e)
+	}
+	log.Printf("Loaded cache snapshot: %v, entries: %d\n", path, len(fc.cache))
+	return nil
+}
+
+// save writes the entries to a snapshot at path, replacing it atomically.
+func (fc *FunctionCache) save(path string) error {
+	fc.lock()
+	entries := make([]snapshotEntry, 0, len(fc.cache))
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		if entry, ok := fc.snapshot(e.Value.(string)); ok {
+			entries = append(entries, entry)
+		}
+	}
+	fc.unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := gob.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
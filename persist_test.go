@@ -0,0 +1,91 @@
+package cached
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test: Unexpired entries survive closing and reopening a persistent cache
+func TestPersistentFunctionCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+
+	// mock cache
+	fc := NewPersistentFunctionCache(context.Background(), path, WithTTL(time.Minute))
+
+	var calls int
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return fmt.Sprintf("value:%v", args[0])
+	}
+	fc.Wrap(f)("fresh")
+	fc.Wrap(f)("old")
+
+	// Age one entry beyond the TTL
+	fc.lock()
+	fc.entry[fmt.Sprintf("%v", []interface{}{"old"})] = time.Now().Add(-time.Hour)
+	fc.unlock()
+	fc.Close()
+
+	fc = NewPersistentFunctionCache(context.Background(), path, WithTTL(time.Minute))
+	defer fc.Close()
+	if size := fc.Stats().Size; size != 1 {
+		t.Errorf("Expected only the unexpired entry to be loaded, got %d entries", size)
+	}
+	if result := fc.Wrap(f)("fresh"); result != "value:fresh" || calls != 2 {
+		t.Errorf("Expected the loaded entry to be served, got %v after %d calls", result, calls)
+	}
+	if result := fc.Wrap(f)("old"); result != "value:old" || calls != 3 {
+		t.Errorf("Expected the expired entry to be recomputed, got %v after %d calls", result, calls)
+	}
+}
+
+// Test: Values in the stored form of the gzip codec and weak values can be persisted
+func TestPersistentFunctionCacheStoredForms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+	encode, decode := NewGzipCodec(1)
+
+	// mock cache
+	fc := NewPersistentFunctionCache(context.Background(), path, WithValueCodec(encode, decode))
+	fc.Set([]byte("compressed"), "k")
+	if err := fc.save(path); err != nil {
+		t.Fatalf("Expected gzipped values to be saved, got %v", err)
+	}
+	fc.Close()
+
+	fc = NewPersistentFunctionCache(context.Background(), path, WithValueCodec(encode, decode))
+	defer fc.Close()
+	if result := fc.Wrap(func(args ...interface{}) interface{} { return nil })("k"); string(result.([]byte)) != "compressed" {
+		t.Errorf("Expected the gzipped value to be loaded, got %v", result)
+	}
+
+	weak := NewFunctionCache(context.Background(), WithWeakValues())
+	defer weak.Close()
+	weak.Set("held weakly", "k")
+	if err := weak.save(path); err != nil {
+		t.Errorf("Expected weak values to be saved, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := fc.WriteTo(&buf); err != nil {
+		t.Errorf("Expected gzipped values to be streamed, got %v", err)
+	}
+}
+
+// Test: A corrupt snapshot starts an empty cache
+func TestPersistentFunctionCacheCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+	if err := os.WriteFile(path, []byte("not a snapshot"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// mock cache
+	fc := NewPersistentFunctionCache(context.Background(), path)
+	defer fc.Close()
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected an empty cache, got %d entries", size)
+	}
+}
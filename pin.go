@@ -0,0 +1,30 @@
+package cached
+
+import "log"
+
+// Pin exempts the entry for the given arguments from expiry and eviction, for derived
+// data that never changes. The key stays pinned when the entry is computed later or
+// removed with Delete or Clear, until Unpin. Pinned entries count towards the size of
+// the cache, so a cache full of pinned entries grows beyond its maximum size.
+func (fc *FunctionCache) Pin(args ...interface{}) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return
+	}
+	fc.lock()
+	defer fc.unlock()
+	fc.pinned[key] = true
+}
+
+// Unpin makes the entry for the given arguments subject to expiry and eviction again.
+func (fc *FunctionCache) Unpin(args ...interface{}) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return
+	}
+	fc.lock()
+	defer fc.unlock()
+	delete(fc.pinned, key)
+}
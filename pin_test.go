@@ -0,0 +1,44 @@
+package cached
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: A pinned entry survives eviction pressure and expiry
+func TestCachedFunctionPin(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(2), WithTTL(20*time.Millisecond), WithLazyExpiry())
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return args[0]
+	})
+
+	fc.Pin("pinned")
+	cachedFunc("pinned")
+	for i := 0; i < 5; i++ {
+		cachedFunc(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	fc.ExpireNow()
+
+	if result := cachedFunc("pinned"); result != "pinned" || calls != 6 {
+		t.Errorf("Expected the pinned entry to be served, got %v after %d calls", result, calls)
+	}
+	if size := fc.Stats().Size; size != 1 {
+		t.Errorf("Expected only the pinned entry to be left, got %d entries", size)
+	}
+
+	// Unpinned, the entry expires again
+	fc.Unpin("pinned")
+	time.Sleep(50 * time.Millisecond)
+	fc.ExpireNow()
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected the unpinned entry to expire, got %d entries", size)
+	}
+}
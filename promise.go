@@ -0,0 +1,74 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ErrPromiseCancelled is returned by Await once the promise was cancelled.
+var ErrPromiseCancelled = errors.New("cached: promise cancelled")
+
+// Promise is the pending result of a call of a function wrapped by WrapPromise.
+type Promise struct {
+	done      chan struct{}
+	cancelled chan struct{}
+	once      sync.Once
+	result    interface{}
+	err       error
+}
+
+// Await waits for the result of the call, until ctx is done or the promise is
+// cancelled. It may be called several times and from several goroutines.
+func (p *Promise) Await(ctx context.Context) (interface{}, error) {
+	select {
+	case <-p.cancelled:
+		return nil, ErrPromiseCancelled
+	default:
+	}
+	select {
+	case <-p.done:
+		return p.result, p.err
+	case <-p.cancelled:
+		return nil, ErrPromiseCancelled
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel detaches the promise from the computation: Await returns
+// ErrPromiseCancelled from then on. The computation itself is shared with the other
+// promises and callers of the same arguments, so it keeps running and its result is
+// cached as usual.
+func (p *Promise) Cancel() {
+	p.once.Do(func() {
+		close(p.cancelled)
+	})
+}
+
+// WrapPromise creates a cached version of a function that may fail which returns at
+// once with a Promise of the result, computing it in the background. Promises for
+// the same arguments share one computation, like concurrent calls of WrapE. A panic
+// of the computation fails its promises with ErrNoResult.
+func (fc *FunctionCache) WrapPromise(f func(args ...interface{}) (interface{}, error)) func(args ...interface{}) *Promise {
+	if f == nil {
+		panic("cached: WrapPromise called with a nil function")
+	}
+	cached := fc.WrapE(f)
+	return func(args ...interface{}) *Promise {
+		p := &Promise{done: make(chan struct{}), cancelled: make(chan struct{})}
+		go func() {
+			defer close(p.done)
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Promised computation panicked: %v, %v\n", args, r)
+					p.err = fmt.Errorf("%w: %v", ErrNoResult, r)
+				}
+			}()
+			p.result, p.err = cached(args...)
+		}()
+		return p
+	}
+}
@@ -0,0 +1,52 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Cancelling one promise leaves the shared computation to the other awaiters
+func TestWrapPromise(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int32
+	release := make(chan struct{})
+	fetch := fc.WrapPromise(func(args ...interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "result", nil
+	})
+
+	promises := []*Promise{fetch("k"), fetch("k"), fetch("k")}
+	time.Sleep(20 * time.Millisecond)
+	promises[1].Cancel()
+	if _, err := promises[1].Await(ctx); !errors.Is(err, ErrPromiseCancelled) {
+		t.Errorf("Expected the cancelled promise to fail, got %v", err)
+	}
+
+	// An awaiter giving up does not affect the promise
+	short, stop := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer stop()
+	if _, err := promises[0].Await(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the await to time out, got %v", err)
+	}
+
+	close(release)
+	for _, i := range []int{0, 2} {
+		if result, err := promises[i].Await(ctx); result != "result" || err != nil {
+			t.Errorf("Expected promise %d to get the result, got %v, %v", i, result, err)
+		}
+	}
+	if _, err := promises[1].Await(ctx); !errors.Is(err, ErrPromiseCancelled) {
+		t.Errorf("Expected the cancelled promise to stay cancelled, got %v", err)
+	}
+	if result, _ := fetch("k").Await(ctx); result != "result" || calls != 1 {
+		t.Errorf("Expected one shared and cached computation, got %v after %d calls", result, calls)
+	}
+}
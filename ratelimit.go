@@ -0,0 +1,80 @@
+package cached
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a computation is rejected by the recompute rate limit.
+var ErrRateLimited = errors.New("cached: recompute rate limit exceeded")
+
+// tokenBucket limits events to rate per second with bursts of up to burst events.
+type tokenBucket struct {
+	m      sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token, going into debt if there is none, and returns how long the
+// caller has to wait before the token is actually available.
+func (tb *tokenBucket) reserve() time.Duration {
+	lock(&tb.m)
+	defer tb.m.Unlock()
+	tb.refill()
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// allow takes a token if one is available right now.
+func (tb *tokenBucket) allow() bool {
+	lock(&tb.m)
+	defer tb.m.Unlock()
+	tb.refill()
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// refill adds the tokens accumulated since the last call. It must be called with tb.m held.
+func (tb *tokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// throttle gates a computation by the recompute rate limit, waiting for a token or
+// rejecting the computation with ErrRateLimited.
+func (fc *FunctionCache) throttle() error {
+	if fc.limiter == nil {
+		return nil
+	}
+	if fc.rejectLimited {
+		if !fc.limiter.allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	time.Sleep(fc.limiter.reserve())
+	return nil
+}
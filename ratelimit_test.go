@@ -0,0 +1,53 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test: Computations beyond the rate limit wait for a token
+func TestCachedFunctionRecomputeRateLimit(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithRecomputeRateLimit(10, 2))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	// Burst distinct keys: 2 run right away, the other 4 at 10 per second
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		cachedFunc(i)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("Expected rate limit to hold, 6 computations took %v", elapsed)
+	}
+}
+
+// Test: Computations beyond the rate limit are rejected
+func TestCachedFunctionRecomputeRateLimitReject(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithRecomputeRateLimit(1, 2), WithRateLimitReject())
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.WrapE(func(args ...interface{}) (interface{}, error) {
+		return args[0], nil
+	})
+
+	var rejected int
+	for i := 0; i < 5; i++ {
+		if _, err := cachedFunc(i); errors.Is(err, ErrRateLimited) {
+			rejected++
+		}
+	}
+	if rejected != 3 {
+		t.Errorf("Expected 3 computations to be rejected, got %d", rejected)
+	}
+}
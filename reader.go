@@ -0,0 +1,37 @@
+package cached
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrReaderTooLarge is returned when a reader holds more than the allowed bytes.
+var ErrReaderTooLarge = errors.New("cached: reader contents too large")
+
+// WrapReader creates a cached version of a function processing the contents of a
+// reader, such as an uploaded file. The reader is read into memory, up to maxBytes
+// bytes, and the SHA-256 of its contents is the key together with the other
+// arguments, so identical contents share an entry. Larger contents fail with
+// ErrReaderTooLarge. Only successful results are cached.
+func (fc *FunctionCache) WrapReader(f func(data []byte, args ...interface{}) (interface{}, error), maxBytes int64) func(r io.Reader, args ...interface{}) (interface{}, error) {
+	if f == nil {
+		panic("cached: WrapReader called with a nil function")
+	}
+	return func(r io.Reader, args ...interface{}) (interface{}, error) {
+		data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrReaderTooLarge, maxBytes)
+		}
+		sum := sha256.Sum256(data)
+		keyArgs := append([]interface{}{"sha256:" + hex.EncodeToString(sum[:])}, args...)
+		return fc.do(keyArgs, func() (interface{}, error) {
+			return f(data, args...)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test: Readers with identical contents hit the same entry
+func TestCachedFunctionWrapReader(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	parse := fc.WrapReader(func(data []byte, args ...interface{}) (interface{}, error) {
+		calls++
+		return strings.Count(string(data), "\n"), nil
+	}, 64)
+
+	for i := 0; i < 2; i++ {
+		if lines, err := parse(strings.NewReader("a\nb\nc\n")); lines != 3 || err != nil {
+			t.Errorf("Expected 3 lines, got %v, %v", lines, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected identical readers to hit, function was called %d times", calls)
+	}
+
+	if _, err := parse(strings.NewReader(strings.Repeat("x", 65))); !errors.Is(err, ErrReaderTooLarge) {
+		t.Errorf("Expected an error past the limit, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the function not to be called past the limit, it was called %d times", calls)
+	}
+}
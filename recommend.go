@@ -0,0 +1,63 @@
+package cached
+
+import "sort"
+
+// accessSamples is the number of recent lookups kept to recommend a cache size.
+const accessSamples = 4096
+
+// sample records a lookup of key in the ring of recent lookups. It must be called
+// with fc.m held.
+func (fc *FunctionCache) sample(key string) {
+	if len(fc.accesses) < accessSamples {
+		fc.accesses = append(fc.accesses, key)
+		return
+	}
+	fc.accesses[fc.nextAccess] = key
+	fc.nextAccess = (fc.nextAccess + 1) % accessSamples
+}
+
+// SizeRecommendation estimates the number of entries an LRU cache needs to serve the
+// recent lookups with a hit rate of at least targetHitRate, between 0 and 1. It
+// replays the last lookups, up to a few thousand, to build their miss ratio curve.
+// When the target cannot be reached because too many lookups are first accesses,
+// the number of distinct keys looked up is returned, beyond which a larger cache
+// does not help. Without lookups it returns 0.
+func (fc *FunctionCache) SizeRecommendation(targetHitRate float64) int {
+	fc.lock()
+	accesses := make([]string, 0, len(fc.accesses))
+	accesses = append(accesses, fc.accesses[fc.nextAccess:]...)
+	accesses = append(accesses, fc.accesses[:fc.nextAccess]...)
+	fc.unlock()
+	if len(accesses) == 0 {
+		return 0
+	}
+
+	// A lookup hits an LRU cache of size n when fewer than n other keys were used since
+	// the last lookup of its key, its stack distance
+	var stack []string
+	var distances []int
+	for _, key := range accesses {
+		i := 0
+		for i < len(stack) && stack[i] != key {
+			i++
+		}
+		if i < len(stack) {
+			distances = append(distances, i)
+			copy(stack[1:i+1], stack[:i])
+		} else {
+			stack = append(stack, "")
+			copy(stack[1:], stack)
+		}
+		stack[0] = key
+	}
+
+	needed := int(targetHitRate*float64(len(accesses)) + 0.5)
+	if needed <= 0 {
+		return 0
+	}
+	if needed > len(distances) {
+		return len(stack)
+	}
+	sort.Ints(distances)
+	return distances[needed-1] + 1
+}
@@ -0,0 +1,58 @@
+package cached
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// Test: The recommended size reaches the target hit rate on a Zipfian workload
+func TestSizeRecommendation(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	workload := make([]uint64, accessSamples)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.2, 1, 9999)
+	distinct := make(map[uint64]bool)
+	for i := range workload {
+		workload[i] = zipf.Uint64()
+		distinct[workload[i]] = true
+	}
+	id := func(args ...interface{}) interface{} {
+		return args[0]
+	}
+
+	fc := NewFunctionCache(ctx, WithMaxSize(100000))
+	if n := fc.SizeRecommendation(0.5); n != 0 {
+		t.Errorf("Expected no recommendation without lookups, got %d", n)
+	}
+	cachedFunc := fc.Wrap(id)
+	for _, k := range workload {
+		cachedFunc(k)
+	}
+
+	for _, target := range []float64{0.3, 0.5, 0.6} {
+		size := fc.SizeRecommendation(target)
+		if size <= 0 || size >= len(distinct) {
+			t.Errorf("Expected a size between 0 and %d for %v, got %d", len(distinct), target, size)
+			continue
+		}
+
+		// Replaying the workload through a cache of that size hits at least the target
+		sized := NewFunctionCache(ctx, WithMaxSize(size), WithEvictionPolicy(LRU))
+		sizedFunc := sized.Wrap(id)
+		for _, k := range workload {
+			sizedFunc(k)
+		}
+		stats := sized.Stats()
+		if rate := float64(stats.Hits) / float64(stats.Hits+stats.Misses); rate < target || rate > target+0.05 {
+			t.Errorf("Expected a hit rate close to %v with %d entries, got %.3f", target, size, rate)
+		}
+	}
+
+	// Unreachable targets recommend all keys seen
+	if size := fc.SizeRecommendation(0.99); size != len(distinct) {
+		t.Errorf("Expected %d entries for an unreachable target, got %d", len(distinct), size)
+	}
+}
@@ -0,0 +1,110 @@
+package cached
+
+import (
+	"container/list"
+	"log"
+	"time"
+)
+
+// Rekey remaps the existing entries after a change of the key scheme. fn is called
+// under the cache lock for every entry in insertion order with its key and value, and
+// returns the key to keep the entry under or keep set to false to drop it. Moved
+// entries keep their age, TTL and eviction position. When several entries end up
+// under the same key, the one moved last wins.
+func (fc *FunctionCache) Rekey(fn func(oldKey string, value interface{}) (newKey string, keep bool)) {
+	fc.lock()
+	defer fc.unlock()
+
+	type move struct {
+		from, to string
+		value    interface{}
+		entry    time.Time
+		size     int
+		uses     int
+		accessed time.Time
+		ttl      time.Duration
+		hasTTL   bool
+		negative bool
+		state    entryState
+		source   Source
+		elem     *list.Element
+	}
+
+	// Decide on all entries first, so that moves cannot clash with keys not yet visited
+	var moves []move
+	var drops []string
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value, err := fc.decode(fc.cache[key])
+		if err != nil {
+			value = fc.cache[key]
+		}
+		newKey, keep := fn(key, value)
+		switch {
+		case !keep:
+			drops = append(drops, key)
+		case newKey != key:
+			moves = append(moves, move{from: key, to: newKey})
+		}
+	}
+	for _, key := range drops {
+		log.Printf("Rekey dropping: %v\n", key)
+		fc.remove(key)
+	}
+
+	// Detach the moved entries, their values stay in use so nothing is released
+	for i := range moves {
+		m := &moves[i]
+		m.value = fc.cache[m.from]
+		m.entry = fc.entry[m.from]
+		m.size = fc.sizes[m.from]
+		m.uses = fc.uses[m.from]
+		m.accessed = fc.accessed[m.from]
+		m.ttl, m.hasTTL = fc.ttls[m.from]
+		m.elem = fc.elems[m.from]
+		m.state = fc.states[m.from]
+		m.source = fc.sources[m.from]
+		delete(fc.cache, m.from)
+		delete(fc.entry, m.from)
+		delete(fc.sizes, m.from)
+		delete(fc.uses, m.from)
+		delete(fc.accessed, m.from)
+		delete(fc.ttls, m.from)
+		delete(fc.elems, m.from)
+		delete(fc.states, m.from)
+		delete(fc.sources, m.from)
+		fc.record(EventDelete, m.from)
+		if m.negative = fc.negs[m.from]; m.negative {
+			delete(fc.negs, m.from)
+		} else {
+			fc.unaccount(m.from)
+		}
+	}
+	for _, m := range moves {
+		log.Printf("Rekey moving: %v -> %v\n", m.from, m.to)
+		fc.remove(m.to)
+		fc.cache[m.to] = m.value
+		fc.entry[m.to] = m.entry
+		fc.sizes[m.to] = m.size
+		if m.uses > 0 {
+			fc.uses[m.to] = m.uses
+			fc.accessed[m.to] = m.accessed
+		}
+		if m.hasTTL {
+			fc.ttls[m.to] = m.ttl
+		}
+		m.elem.Value = m.to
+		fc.elems[m.to] = m.elem
+		fc.record(EventAdd, m.to)
+		fc.sources[m.to] = m.source
+		if fc.states != nil {
+			fc.states[m.to] = m.state
+		}
+		switch {
+		case m.negative:
+			fc.negs[m.to] = true
+		case fc.partition != nil:
+			fc.partSizes[fc.partitionOf(m.to)]++
+		}
+	}
+}
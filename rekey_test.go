@@ -0,0 +1,51 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Test: Entries are remapped to the new key scheme or dropped
+func TestCachedFunctionRekey(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	f := func(args ...interface{}) interface{} {
+		calls++
+		return fmt.Sprint(args...)
+	}
+	fc.Wrap(f)("a")
+	fc.Wrap(f)("b")
+	fc.Wrap(f)("drop")
+
+	// Switch to a key function adding a version prefix
+	fc.keyFunc = func(args ...interface{}) string {
+		return "v2" + DefaultKey(args...)
+	}
+	fc.Rekey(func(oldKey string, value interface{}) (string, bool) {
+		if strings.Contains(oldKey, "drop") {
+			return "", false
+		}
+		return "v2" + oldKey, true
+	})
+
+	cachedFunc := fc.Wrap(f)
+	if result := cachedFunc("a"); result != "a" {
+		t.Errorf("Expected the moved value, got %v", result)
+	}
+	cachedFunc("b")
+	if calls != 3 {
+		t.Errorf("Expected lookups under the new scheme to hit, function was called %d times", calls)
+	}
+	if size := fc.Stats().Size; size != 2 {
+		t.Errorf("Expected 2 entries after rekeying, got %d", size)
+	}
+	if fc.order.Len() != 2 || fc.order.Front().Value != "v2[a]" {
+		t.Errorf("Expected the eviction order to follow the moved keys")
+	}
+}
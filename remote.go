@@ -0,0 +1,154 @@
+package cached
+
+import (
+	"encoding/gob"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Cache is a Store whose entries can also be deleted. It is implemented by the view
+// of a FunctionCache returned by AsStore and by a Client of a cache served by Serve.
+type Cache interface {
+	Store
+	// Delete removes the entry stored under key.
+	Delete(key string)
+}
+
+// remote operations
+const (
+	opGet    = "get"
+	opSet    = "set"
+	opDelete = "delete"
+)
+
+// request is a gob encoded call of a Client.
+type request struct {
+	Op    string
+	Key   string
+	Value interface{}
+	TTL   time.Duration
+}
+
+// response is the gob encoded answer of Serve to a request.
+type response struct {
+	Value interface{}
+	Found bool
+	Err   string
+}
+
+// Delete removes the entry stored under key.
+func (s fcStore) Delete(key string) {
+	s.fc.deleteKey(key)
+}
+
+// Serve accepts connections on l and answers the Get, Set and Delete calls of Clients
+// on them, sharing the cache with other processes. Keys are the raw cache keys, as for
+// AsStore, and values of types other than the basic ones must be registered with
+// gob.Register in both processes. Serve returns when l fails, e.g. once it is closed.
+func (fc *FunctionCache) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go fc.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests of one connection until it is closed.
+func (fc *FunctionCache) serveConn(conn net.Conn) {
+	defer conn.Close()
+	store := fcStore{fc}
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		var resp response
+		switch req.Op {
+		case opGet:
+			resp.Value, resp.Found = store.Get(req.Key)
+		case opSet:
+			store.Set(req.Key, req.Value, req.TTL)
+		case opDelete:
+			store.Delete(req.Key)
+		default:
+			resp.Err = "unknown operation " + req.Op
+		}
+		if err := enc.Encode(&resp); err != nil {
+			log.Printf("Answering remote %v failed: %v, %v\n", req.Op, req.Key, err)
+			return
+		}
+	}
+}
+
+// Client is a Cache backed by a FunctionCache served by Serve in another process.
+// Calls are serialized over one connection. Failed calls are logged and treated as
+// misses, so a Client can stand in as the second level of a TwoLevel cache.
+type Client struct {
+	m    sync.Mutex
+	conn net.Conn
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+}
+
+// Dial connects a Client to the cache served at address on the named network.
+func Dial(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates a Client talking to a cache served on the other end of conn.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, enc: gob.NewEncoder(conn), dec: gob.NewDecoder(conn)}
+}
+
+// Get returns the value stored under key and whether it was found.
+func (c *Client) Get(key string) (interface{}, bool) {
+	resp, err := c.call(request{Op: opGet, Key: key})
+	if err != nil {
+		return nil, false
+	}
+	return resp.Value, resp.Found
+}
+
+// Set stores value under key for ttl.
+func (c *Client) Set(key string, value interface{}, ttl time.Duration) {
+	c.call(request{Op: opSet, Key: key, Value: value, TTL: ttl})
+}
+
+// Delete removes the entry stored under key.
+func (c *Client) Delete(key string) {
+	c.call(request{Op: opDelete, Key: key})
+}
+
+// Close closes the connection of the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// call sends req and waits for its response.
+func (c *Client) call(req request) (response, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var resp response
+	err := c.enc.Encode(&req)
+	if err == nil {
+		err = c.dec.Decode(&resp)
+	}
+	if err == nil && resp.Err != "" {
+		err = errors.New(resp.Err)
+	}
+	if err != nil {
+		log.Printf("Remote %v failed: %v, %v\n", req.Op, req.Key, err)
+	}
+	return resp, err
+}
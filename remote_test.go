@@ -0,0 +1,87 @@
+package cached
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeListener is a net.Listener handing out in-memory pipes.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.done)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial connects a client end of a new pipe to the listener.
+func (l *pipeListener) dial() net.Conn {
+	client, server := net.Pipe()
+	l.conns <- server
+	return client
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// Test: Clients share entries with the serving cache and each other
+func TestServeClient(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	l := newPipeListener()
+	served := make(chan error, 1)
+	go func() {
+		served <- fc.Serve(l)
+	}()
+
+	var a, b Cache = NewClient(l.dial()), NewClient(l.dial())
+	a.Set("k", "v", time.Minute)
+	if v, found := b.Get("k"); v != "v" || !found {
+		t.Errorf("Expected the value set by another client, got %v, %v", v, found)
+	}
+	if v, found := fc.AsStore().Get("k"); v != "v" || !found {
+		t.Errorf("Expected the value in the serving cache, got %v, %v", v, found)
+	}
+
+	// Entries computed by the server are visible to clients
+	fc.Wrap(func(args ...interface{}) interface{} { return 42 })("n")
+	if v, found := a.Get(DefaultKey("n")); v != 42 || !found {
+		t.Errorf("Expected the computed value, got %v, %v", v, found)
+	}
+
+	b.Delete("k")
+	if _, found := a.Get("k"); found {
+		t.Errorf("Expected the deleted entry to be gone")
+	}
+
+	l.Close()
+	if err := <-served; err != net.ErrClosed {
+		t.Errorf("Expected Serve to return when the listener is closed, got %v", err)
+	}
+}
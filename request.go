@@ -0,0 +1,92 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// requestCacheKey is the context key of the RequestCache of a request.
+const requestCacheKey contextKey = "cached-request-cache"
+
+// RequestCache memoizes results for the duration of one request, e.g. an HTTP
+// handler invocation. It has no expiry, no eviction and no background goroutine: its
+// entries are simply dropped with it when the request ends. Concurrent calls within
+// the request are deduplicated.
+type RequestCache struct {
+	m      sync.Mutex
+	values map[string]interface{}
+	group  *Group
+}
+
+// NewRequestCache creates an empty RequestCache.
+func NewRequestCache() *RequestCache {
+	return &RequestCache{values: make(map[string]interface{}), group: NewGroup()}
+}
+
+// Attach returns a copy of ctx carrying rc, for functions wrapped by WrapRequest.
+func (rc *RequestCache) Attach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCacheKey, rc)
+}
+
+// RequestCacheFrom returns the RequestCache attached to ctx, or nil if there is none.
+func RequestCacheFrom(ctx context.Context) *RequestCache {
+	rc, _ := ctx.Value(requestCacheKey).(*RequestCache)
+	return rc
+}
+
+// do returns the value memoized under key, computing it on a miss.
+func (rc *RequestCache) do(key string, compute func() (interface{}, error)) (interface{}, error) {
+	rc.m.Lock()
+	result, found := rc.values[key]
+	rc.m.Unlock()
+	if found {
+		return result, nil
+	}
+	result, err, _ := rc.group.do(key, 0, false, func() (interface{}, error) {
+		result, err := compute()
+		if err == nil {
+			rc.m.Lock()
+			rc.values[key] = result
+			rc.m.Unlock()
+		}
+		return result, err
+	})
+	return result, err
+}
+
+// WrapRequest creates a cached version of a function taking a context which is
+// memoized in the RequestCache attached to the context, if any, and cached in this
+// cache otherwise, like WrapContext. Keys are built by this cache, and entries of
+// different caches sharing a RequestCache are kept apart.
+func (fc *FunctionCache) WrapRequest(f func(ctx context.Context, args ...interface{}) interface{}) func(ctx context.Context, args ...interface{}) interface{} {
+	if f == nil {
+		panic("cached: WrapRequest called with a nil function")
+	}
+	cached := fc.WrapContext(f)
+	return func(ctx context.Context, args ...interface{}) interface{} {
+		rc := RequestCacheFrom(ctx)
+		if rc == nil {
+			return cached(ctx, args...)
+		}
+		args = fc.transformed(args)
+		key, err := fc.key(args)
+		if err != nil {
+			log.Printf("Warning: %v, computing uncached\n", err)
+			return f(ctx, args...)
+		}
+		result, err := rc.do(fmt.Sprintf("%p", fc)+partitionSep+key, func() (interface{}, error) {
+			return f(ctx, args...), nil
+		})
+		if errors.Is(err, ErrRecursiveCall) {
+			return f(ctx, args...)
+		}
+		if err != nil {
+			log.Printf("No result available, returning default: %v\n", err)
+			return fc.defaultResult()
+		}
+		return result
+	}
+}
@@ -0,0 +1,43 @@
+package cached
+
+import (
+	"context"
+	"testing"
+)
+
+// Test: Calls within a request share a value, a new request recomputes
+func TestWrapRequest(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	user := fc.WrapRequest(func(ctx context.Context, args ...interface{}) interface{} {
+		calls++
+		return calls
+	})
+	other := NewFunctionCache(ctx).WrapRequest(func(ctx context.Context, args ...interface{}) interface{} {
+		return "other"
+	})
+
+	first := NewRequestCache().Attach(ctx)
+	if a, b := user(first, "id"), user(first, "id"); a != 1 || b != 1 {
+		t.Errorf("Expected calls in one request to share 1, got %v, %v", a, b)
+	}
+	if result := other(first, "id"); result != "other" {
+		t.Errorf("Expected entries of different caches to be kept apart, got %v", result)
+	}
+	second := NewRequestCache().Attach(ctx)
+	if result := user(second, "id"); result != 2 {
+		t.Errorf("Expected a new request to recompute, got %v", result)
+	}
+
+	// Without a request cache the instance cache is used
+	if a, b := user(ctx, "id"), user(ctx, "id"); a != 3 || b != 3 || calls != 3 {
+		t.Errorf("Expected the instance cache to serve 3, got %v, %v after %d calls", a, b, calls)
+	}
+	if RequestCacheFrom(ctx) != nil {
+		t.Errorf("Expected no request cache in a plain context")
+	}
+}
@@ -0,0 +1,82 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ResolverCache caches host name lookups, keeping found addresses for a positive TTL
+// and hosts that do not exist for a usually shorter negative TTL. Concurrent lookups
+// of the same host share one resolution.
+type ResolverCache struct {
+	fc      *FunctionCache
+	resolve func(host string) ([]string, error)
+	negTTL  time.Duration
+}
+
+// NewResolverCache creates a ResolverCache in front of resolve, e.g.
+// net.DefaultResolver.LookupHost bound to a context. Lookups failing with a
+// *net.DNSError whose IsNotFound is set or with ErrNotFound are cached for negTTL,
+// other errors such as timeouts are not cached. Options configure the underlying
+// FunctionCache, whose TTL is posTTL.
+func NewResolverCache(resolve func(host string) ([]string, error), posTTL, negTTL time.Duration, opts ...Option) *ResolverCache {
+	if resolve == nil {
+		panic("cached: NewResolverCache called with a nil function")
+	}
+	opts = append(opts, WithTTL(posTTL))
+	return &ResolverCache{
+		fc:      NewFunctionCache(context.Background(), opts...),
+		resolve: resolve,
+		negTTL:  negTTL,
+	}
+}
+
+// Lookup returns the addresses of host. Hosts that do not exist fail with an error
+// wrapping ErrNotFound.
+func (r *ResolverCache) Lookup(host string) ([]string, error) {
+	args := []interface{}{host}
+	result, hit, err := r.fc.doReport(args, func() (interface{}, error) {
+		addrs, err := r.resolve(host)
+		var dnsErr *net.DNSError
+		if errors.Is(err, ErrNotFound) || errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return negative{}, nil
+		}
+		return addrs, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := result.(negative); ok {
+		if !hit {
+			r.expireAfter(args, r.negTTL)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, host)
+	}
+	return result.([]string), nil
+}
+
+// expireAfter applies ttl to the entry of args.
+func (r *ResolverCache) expireAfter(args []interface{}, ttl time.Duration) {
+	key, err := r.fc.key(args)
+	if err != nil {
+		return
+	}
+	r.fc.lock()
+	defer r.fc.unlock()
+	if _, found := r.fc.cache[key]; found {
+		r.fc.ttls[key] = ttl
+	}
+}
+
+// Cache returns the FunctionCache holding the lookups, e.g. for its Stats.
+func (r *ResolverCache) Cache() *FunctionCache {
+	return r.fc
+}
+
+// Close stops the underlying cache.
+func (r *ResolverCache) Close() {
+	r.fc.Close()
+}
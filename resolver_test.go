@@ -0,0 +1,53 @@
+package cached
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Concurrent lookups share one resolution and negatives expire sooner
+func TestResolverCache(t *testing.T) {
+	var calls int32
+	r := NewResolverCache(func(host string) ([]string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		if host == "missing.example" {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []string{"192.0.2.1"}, nil
+	}, time.Hour, 50*time.Millisecond)
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if addrs, err := r.Lookup("example.com"); err != nil || len(addrs) != 1 {
+				t.Errorf("Expected one address, got %v, %v", addrs, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := r.Lookup("missing.example"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 2 {
+		t.Errorf("Expected one resolution per host, got %d", calls)
+	}
+
+	// The negative expires, the positive is still cached
+	time.Sleep(60 * time.Millisecond)
+	r.Lookup("example.com")
+	r.Lookup("missing.example")
+	if calls != 3 {
+		t.Errorf("Expected only the negative to be resolved again, got %d resolutions", calls)
+	}
+}
@@ -0,0 +1,87 @@
+package cached
+
+import (
+	"log"
+	"time"
+)
+
+// entryState is the state of an entry in a cache serving stale values while
+// revalidating them.
+type entryState int
+
+const (
+	// stateFresh is an entry within its expiry time, served as is
+	stateFresh entryState = iota
+	// stateStale is an expired entry still served, the next reader starts its refresh
+	stateStale
+	// stateRefreshing is an expired entry still served while its one refresh runs
+	stateRefreshing
+)
+
+// String returns the name of the entry state.
+func (s entryState) String() string {
+	switch s {
+	case stateFresh:
+		return "fresh"
+	case stateStale:
+		return "stale"
+	case stateRefreshing:
+		return "refreshing"
+	}
+	return "unknown"
+}
+
+// serveStale reports whether the expired entry of key is kept and served while it is
+// revalidated, moving a fresh entry to stale. Entries which stayed stale for another
+// expiry time without a reader are not kept. It must be called with fc.m held.
+func (fc *FunctionCache) serveStale(key string) bool {
+	if fc.states == nil {
+		return false
+	}
+	if fc.states[key] == stateFresh {
+		fc.states[key] = stateStale
+	}
+	return fc.states[key] == stateRefreshing || time.Since(fc.entry[key]) <= 2*fc.ttlOf(key)
+}
+
+// revalidate reports whether the reader of a hit on key has to refresh the entry,
+// moving a stale entry to refreshing so that exactly one reader does. It must be
+// called with fc.m held.
+func (fc *FunctionCache) revalidate(key string) bool {
+	if fc.states == nil || !fc.isExpired(key) || !fc.serveStale(key) {
+		return false
+	}
+	if fc.states[key] != stateStale {
+		return false
+	}
+	fc.states[key] = stateRefreshing
+	return true
+}
+
+// refresh recomputes key in the background while its stale value is served. Storing
+// the new value makes the entry fresh, if the computation fails or its result is not
+// stored the entry goes back to stale and the next reader retries.
+func (fc *FunctionCache) refresh(key string, compute func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Refresh panicked: %v, %v\n", key, r)
+		}
+		fc.lock()
+		fc.unrefresh(key)
+		fc.unlock()
+	}()
+	_, err, _ := fc.group.do(key, fc.waiters, fc.recursion, func() (interface{}, error) {
+		return fc.compute(key, compute)
+	})
+	if err != nil {
+		log.Printf("Refresh failed, serving stale value: %v, %v\n", key, err)
+	}
+}
+
+// unrefresh moves an entry left refreshing by a refresh which did not store a value,
+// or never ran, back to stale. It must be called with fc.m held.
+func (fc *FunctionCache) unrefresh(key string) {
+	if fc.states[key] == stateRefreshing {
+		fc.states[key] = stateStale
+	}
+}
@@ -0,0 +1,159 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// state returns the state of the entry of key.
+func state(fc *FunctionCache, key string) entryState {
+	fc.lock()
+	defer fc.unlock()
+	return fc.states[key]
+}
+
+// Test: Expired entries go stale, are refreshed once while served and become fresh
+func TestStaleWhileRevalidate(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(50*time.Millisecond), WithStaleWhileRevalidate())
+
+	var calls int32
+	gate := make(chan struct{})
+	version := fc.Wrap(func(args ...interface{}) interface{} {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-gate
+		}
+		return int(atomic.LoadInt32(&calls))
+	})
+	key := DefaultKey("v")
+
+	if v := version("v"); v != 1 || state(fc, key) != stateFresh {
+		t.Fatalf("Expected a fresh 1, got %v, %v", v, state(fc, key))
+	}
+	time.Sleep(60 * time.Millisecond)
+	fc.ExpireNow()
+	if s := state(fc, key); s != stateStale {
+		t.Fatalf("Expected the expired entry to be stale, got %v", s)
+	}
+
+	// All concurrent readers get the stale value, one of them starts the refresh
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v := version("v"); v != 1 {
+				t.Errorf("Expected the stale value 1, got %v", v)
+			}
+		}()
+	}
+	wg.Wait()
+	if s := state(fc, key); s != stateRefreshing {
+		t.Errorf("Expected the entry to be refreshing, got %v", s)
+	}
+	if v := version("v"); v != 1 {
+		t.Errorf("Expected the stale value during the refresh, got %v", v)
+	}
+
+	// The refreshed value is fresh
+	close(gate)
+	deadline := time.Now().Add(time.Second)
+	for state(fc, key) != stateFresh && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if v := version("v"); v != 2 {
+		t.Errorf("Expected the refreshed value 2, got %v", v)
+	}
+	if calls != 2 {
+		t.Errorf("Expected exactly one refresh, function was called %d times", calls)
+	}
+}
+
+// Test: A failed refresh makes the entry stale again and unread stale entries expire
+func TestStaleWhileRevalidateFailure(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(50*time.Millisecond), WithStaleWhileRevalidate())
+
+	var calls int32
+	lookup := fc.WrapE(func(args ...interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return nil, errors.New("backend down")
+		}
+		return "ok", nil
+	})
+	key := DefaultKey("k")
+
+	lookup("k")
+	time.Sleep(60 * time.Millisecond)
+	if v, err := lookup("k"); v != "ok" || err != nil {
+		t.Errorf("Expected the stale value, got %v, %v", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for state(fc, key) != stateStale && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := state(fc, key); s != stateStale {
+		t.Errorf("Expected the entry to be stale after a failed refresh, got %v", s)
+	}
+
+	// Not read for another expiry time, the entry is removed
+	time.Sleep(50 * time.Millisecond)
+	fc.ExpireNow()
+	if _, found := fc.EntryInfo("k"); found {
+		t.Errorf("Expected the unread stale entry to be removed")
+	}
+}
+
+// Test: A refresh dropped by a full worker queue leaves the entry stale for the next reader
+func TestStaleWhileRevalidateQueueFull(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithTTL(20*time.Millisecond), WithStaleWhileRevalidate(), WithBackgroundWorkers(1, 0))
+
+	// Saturate the only worker
+	busy := make(chan struct{})
+	release := make(chan struct{})
+	for !fc.spawn(func() {
+		close(busy)
+		<-release
+	}) {
+		// The worker is not waiting for jobs yet
+		time.Sleep(time.Millisecond)
+	}
+	<-busy
+
+	var calls int32
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return int(atomic.AddInt32(&calls, 1))
+	})
+	key := DefaultKey("v")
+	cachedFunc("v")
+	time.Sleep(30 * time.Millisecond)
+	if v := cachedFunc("v"); v != 1 {
+		t.Errorf("Expected the stale value, got %v", v)
+	}
+	if s := state(fc, key); s != stateStale {
+		t.Errorf("Expected the entry to stay stale when its refresh was dropped, got %v", s)
+	}
+
+	// Once the worker is free the next reader refreshes the entry
+	close(release)
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&calls) < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the entry to be refreshed by a later reader")
+		}
+		cachedFunc("v")
+	}
+}
@@ -0,0 +1,80 @@
+package cached
+
+import (
+	"log"
+	"time"
+)
+
+// Stats holds the counters of a FunctionCache. The counters are 64 bits wide on all
+// platforms, so they do not wrap around within any realistic uptime.
+//
+// FullInserts counts the inserts which found the cache full and evicted, a high share
+// of Inserts means the cache is too small for the working set. MissWarnings counts the
+// windows of lookups which nearly all missed, a sign of keys including a unique value
+// such as a timestamp or request ID. Oversized counts the results not cached for being
+// larger than WithMaxValueBytes allows.
+type Stats struct {
+	Hits         int64   `json:"hits"`
+	Misses       int64   `json:"misses"`
+	Evictions    int64   `json:"evictions"`
+	Inserts      int64   `json:"inserts"`
+	FullInserts  int64   `json:"full_inserts"`
+	Expirations  int64   `json:"expirations"`
+	Size         int     `json:"size"`
+	Bytes        int64   `json:"bytes"`
+	Drops        int64   `json:"drops"`
+	MissWarnings int64   `json:"miss_warnings"`
+	Oversized    int64   `json:"oversized"`
+	Latency      Latency `json:"latency"`
+}
+
+// Stats returns a snapshot of the cache counters.
+func (fc *FunctionCache) Stats() Stats {
+	fc.lock()
+	defer fc.unlock()
+	return Stats{
+		Hits:         fc.hits.Load(),
+		Misses:       fc.misses.Load(),
+		Evictions:    fc.evictions.Load(),
+		Inserts:      fc.inserts.Load(),
+		FullInserts:  fc.fullInserts.Load(),
+		Expirations:  fc.expired.Load(),
+		Size:         len(fc.cache),
+		Bytes:        fc.bytes,
+		Drops:        fc.drops.Load(),
+		MissWarnings: fc.missWarnings.Load(),
+		Oversized:    fc.oversized.Load(),
+		Latency:      fc.Latency(),
+	}
+}
+
+// missWindow is the number of lookups over which the miss rate is watched.
+const missWindow = 1000
+
+// missRateWarning is the miss rate over a window above which a warning is logged.
+const missRateWarning = 0.99
+
+// watchMissRate counts a lookup of key and warns when nearly all lookups of the
+// current window missed. It must be called with fc.m held.
+func (fc *FunctionCache) watchMissRate(hit bool, key string) {
+	fc.window++
+	if !hit {
+		fc.windowMisses++
+	}
+	if fc.window < missWindow {
+		return
+	}
+	if rate := float64(fc.windowMisses) / float64(fc.window); rate > missRateWarning {
+		fc.missWarnings.Add(1)
+		log.Printf("Warning: %.1f%% of the last %d lookups missed, the key may include a unique value, e.g. %v\n", rate*100, fc.window, key)
+	}
+	fc.window = 0
+	fc.windowMisses = 0
+}
+
+// InFlight returns the number of keys being computed through this cache and the age
+// of the oldest computation, see Group.InFlight. With a group shared by several
+// caches, the computations of all of them are reported.
+func (fc *FunctionCache) InFlight() (keys int, oldest time.Duration) {
+	return fc.group.InFlight()
+}
@@ -0,0 +1,185 @@
+package cached
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// Test: Stats count hits, misses and evictions
+func TestFunctionCacheStats(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(2))
+
+	// Create a cached version of a simple function
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	cachedFunc(1)
+	cachedFunc(1)
+	cachedFunc(2)
+	cachedFunc(3)
+
+	stats := fc.Stats()
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// Test: Computation latencies are summarized from the histogram
+func TestFunctionCacheLatency(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Nine fast computations and a slow one
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		time.Sleep(args[0].(time.Duration))
+		return args[1]
+	})
+	for i := 0; i < 9; i++ {
+		cachedFunc(5*time.Millisecond, i)
+	}
+	cachedFunc(40*time.Millisecond, 9)
+	cachedFunc(40*time.Millisecond, 9)
+
+	latency := fc.Stats().Latency
+	if latency.Count != 10 {
+		t.Errorf("Expected 10 computations to be recorded, got %d", latency.Count)
+	}
+	if latency.Min < 5*time.Millisecond || latency.Max < 40*time.Millisecond {
+		t.Errorf("Unexpected latency range: %+v", latency)
+	}
+	if latency.P50 < 5*time.Millisecond || latency.P50 > 20*time.Millisecond {
+		t.Errorf("Expected the median in the fast bucket, got %v", latency.P50)
+	}
+	if latency.P99 != latency.Max {
+		t.Errorf("Expected the 99th percentile in the slow bucket, got %v", latency.P99)
+	}
+	if latency.Mean < 8*time.Millisecond {
+		t.Errorf("Expected the mean to include the slow computation, got %v", latency.Mean)
+	}
+}
+
+// Test: Lookups of all-unique keys raise a miss rate warning
+func TestFunctionCacheMissRateWarning(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+
+	// A stable key hit over and over does not warn
+	for i := 0; i < missWindow; i++ {
+		cachedFunc("stable")
+	}
+	if warnings := fc.Stats().MissWarnings; warnings != 0 {
+		t.Errorf("Expected no warning for hits, got %d", warnings)
+	}
+
+	// A request id in the key never hits
+	for i := 0; i < missWindow; i++ {
+		cachedFunc("request", i)
+	}
+	if warnings := fc.Stats().MissWarnings; warnings != 1 {
+		t.Errorf("Expected a warning for unique keys, got %d", warnings)
+	}
+}
+
+// Test: Counters keep counting past the 32-bit range
+func TestFunctionCacheStatsLargeCounters(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	// Start right below the largest 32-bit value
+	fc.hits.Store(math.MaxInt32)
+	fc.misses.Store(math.MaxInt32)
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	cachedFunc(1)
+
+	stats := fc.Stats()
+	if stats.Hits != math.MaxInt32+1 || stats.Misses != math.MaxInt32+1 {
+		t.Errorf("Expected counters past the 32-bit range, got %+v", stats)
+	}
+}
+
+// Test: Inserts into a full cache are counted
+func TestFunctionCacheFullInserts(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(3))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	for i := 0; i < 3; i++ {
+		cachedFunc(i)
+	}
+	if stats := fc.Stats(); stats.Inserts != 3 || stats.FullInserts != 0 {
+		t.Errorf("Expected no full inserts while filling the cache, got %+v", stats)
+	}
+
+	for i := 3; i < 8; i++ {
+		cachedFunc(i)
+	}
+	if stats := fc.Stats(); stats.Inserts != 8 || stats.FullInserts != 5 {
+		t.Errorf("Expected every insert into the full cache to be counted, got %+v", stats)
+	}
+}
+
+// Test: The age of the oldest in-flight computation grows while its leader is stuck
+func TestFunctionCacheInFlight(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	if keys, oldest := fc.InFlight(); keys != 0 || oldest != 0 {
+		t.Errorf("Expected nothing in flight, got %d keys, %v", keys, oldest)
+	}
+
+	release := make(chan struct{})
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		<-release
+		return args[0]
+	})
+	done := make(chan struct{})
+	for _, arg := range []string{"a", "b"} {
+		go func(arg string) {
+			cachedFunc(arg)
+			done <- struct{}{}
+		}(arg)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	keys, first := fc.InFlight()
+	if keys != 2 || first < 30*time.Millisecond {
+		t.Errorf("Expected 2 keys in flight for at least 30ms, got %d, %v", keys, first)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, second := fc.InFlight(); second < first+30*time.Millisecond {
+		t.Errorf("Expected the oldest age to grow from %v, got %v", first, second)
+	}
+
+	close(release)
+	<-done
+	<-done
+	if keys, oldest := fc.InFlight(); keys != 0 || oldest != 0 {
+		t.Errorf("Expected nothing in flight once finished, got %d keys, %v", keys, oldest)
+	}
+}
@@ -0,0 +1,148 @@
+package cached
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
+	"time"
+)
+
+// streamBatch is the number of entries WriteTo copies per lock acquisition.
+const streamBatch = 256
+
+// maxStreamRecord is the size above which ReadFrom rejects a record as corrupt.
+const maxStreamRecord = 1 << 30
+
+// errRecordTooLarge is returned by ReadFrom for records over maxStreamRecord.
+var errRecordTooLarge = errors.New("cached: stream record too large")
+
+// WriteTo streams the entries to w in eviction order as length-prefixed gob records,
+// for backups of large caches. The lock is only held to copy a batch of entries at a
+// time, so entries removed meanwhile are skipped and entries added meanwhile may be
+// missing. Values of types other than the basic ones must be registered with
+// gob.Register. It returns the number of bytes written.
+func (fc *FunctionCache) WriteTo(w io.Writer) (int64, error) {
+	fc.lock()
+	keys := make([]string, 0, len(fc.cache))
+	for e := fc.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	fc.unlock()
+
+	var written int64
+	var buf bytes.Buffer
+	batch := make([]snapshotEntry, 0, streamBatch)
+	for len(keys) > 0 {
+		n := min(streamBatch, len(keys))
+		batch = batch[:0]
+		fc.lock()
+		for _, key := range keys[:n] {
+			if e, ok := fc.snapshot(key); ok {
+				batch = append(batch, e)
+			}
+		}
+		fc.unlock()
+		keys = keys[n:]
+
+		for _, e := range batch {
+			buf.Reset()
+			if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+				return written, err
+			}
+			prefix := binary.AppendUvarint(nil, uint64(buf.Len()))
+			n, err := w.Write(append(prefix, buf.Bytes()...))
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom stores the unexpired entries streamed by WriteTo from r until its end,
+// keeping their age and TTL. It returns the number of bytes read.
+func (fc *FunctionCache) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	br := bufio.NewReader(cr)
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return cr.n - int64(br.Buffered()), nil
+		}
+		if err == nil && size > maxStreamRecord {
+			err = errRecordTooLarge
+		}
+		if err != nil {
+			return cr.n - int64(br.Buffered()), err
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return cr.n - int64(br.Buffered()), err
+		}
+		var e snapshotEntry
+		if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&e); err != nil {
+			return cr.n - int64(br.Buffered()), err
+		}
+		fc.lock()
+		fc.restore(e)
+		fc.unlock()
+	}
+}
+
+// restore stores the snapshot entry e unless it expired, keeping its age and TTL. It
+// must be called with fc.m held.
+func (fc *FunctionCache) restore(e snapshotEntry) {
+	ttl := e.TTL
+	if ttl == 0 {
+		ttl = fc.expiry()
+	}
+	if time.Since(e.Entry) > ttl {
+		return
+	}
+	if fc.weakValues {
+		e.Value = weaken(e.Value)
+	}
+	fc.storeFrom(e.Key, e.Value, SourceSnapshot)
+	fc.entry[e.Key] = e.Entry
+	if e.TTL != 0 {
+		fc.ttls[e.Key] = e.TTL
+	}
+}
+
+// snapshot returns the entry stored under key as written to snapshots, with a weakly
+// held value made strong, and whether there is one to write. It must be called with
+// fc.m held.
+func (fc *FunctionCache) snapshot(key string) (snapshotEntry, bool) {
+	value, found := fc.cache[key]
+	if !found {
+		return snapshotEntry{}, false
+	}
+	if fc.weakValues {
+		var err error
+		if value, err = strengthen(value); err != nil {
+			return snapshotEntry{}, false
+		}
+	}
+	return snapshotEntry{Key: key, Value: value, Entry: fc.entry[key], TTL: fc.ttls[key]}, true
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader, counting the bytes.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
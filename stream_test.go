@@ -0,0 +1,63 @@
+package cached
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test: A large cache survives streaming it out and back in
+func TestWriteToReadFrom(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithMaxSize(10000), WithTTL(time.Hour))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		if n := args[0].(int); n%2 == 0 {
+			return n * n
+		}
+		return fmt.Sprint("value", args[0])
+	})
+	for i := 0; i < 5000; i++ {
+		cachedFunc(i)
+	}
+	fc.AsStore().Set("short", "lived", time.Minute)
+
+	var buf bytes.Buffer
+	written, err := fc.WriteTo(&buf)
+	if err != nil || written != int64(buf.Len()) {
+		t.Fatalf("Expected %d bytes written, got %d, %v", buf.Len(), written, err)
+	}
+
+	restored := NewFunctionCache(ctx, WithMaxSize(10000), WithTTL(time.Hour))
+	read, err := restored.ReadFrom(&buf)
+	if err != nil || read != written {
+		t.Fatalf("Expected %d bytes read, got %d, %v", written, read, err)
+	}
+
+	if got, want := restored.Stats().Size, fc.Stats().Size; got != want {
+		t.Errorf("Expected %d entries, got %d", want, got)
+	}
+	fc.lock()
+	restored.lock()
+	for key, value := range fc.cache {
+		if restored.cache[key] != value {
+			t.Errorf("Expected %v for %v, got %v", value, key, restored.cache[key])
+		}
+		if !restored.entry[key].Equal(fc.entry[key]) || restored.ttls[key] != fc.ttls[key] {
+			t.Errorf("Expected the age and TTL of %v to be kept", key)
+		}
+	}
+	restored.unlock()
+	fc.unlock()
+
+	// Truncated streams fail
+	var short bytes.Buffer
+	fc.WriteTo(&short)
+	if _, err := restored.ReadFrom(bytes.NewReader(short.Bytes()[:short.Len()-3])); err == nil {
+		t.Errorf("Expected an error for a truncated stream")
+	}
+}
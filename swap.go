@@ -0,0 +1,145 @@
+package cached
+
+import (
+	"log"
+	"time"
+)
+
+// Set stores value for the given arguments, replacing any entry. Unlike with Swap, the
+// replaced value is released like a removed one: passed to the OnEvict hook and closed.
+func (fc *FunctionCache) Set(value interface{}, args ...interface{}) {
+	fc.set(value, args, false)
+}
+
+// Swap atomically stores value for the given arguments and returns the value it
+// replaced and whether there was one. The replaced value is handed to the caller, so
+// it is neither passed to the OnEvict hook nor closed. With WithSetWakesWaiters the
+// waiters of a computation of the arguments in flight get value.
+func (fc *FunctionCache) Swap(value interface{}, args ...interface{}) (old interface{}, existed bool) {
+	return fc.set(value, args, true)
+}
+
+// set stores value for args, handing the replaced value to the caller if keep is set
+// and releasing it otherwise.
+func (fc *FunctionCache) set(value interface{}, args []interface{}, keep bool) (old interface{}, existed bool) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return nil, false
+	}
+	stored, err := fc.encode(value)
+	if err != nil {
+		log.Printf("Encoding failed, not storing: %v, %v\n", key, err)
+		return nil, false
+	}
+
+	if fc.setWakes {
+		// Deferred first, so that the waiters wake after the lock is released
+		defer fc.group.resolve(key, value)
+	}
+	fc.lock()
+	defer fc.unlock()
+	prev, existed := fc.lookup(key)
+	if !existed {
+		fc.storeFrom(key, stored, SourceSet)
+		if fc.setKeepsOrder {
+			// Primed entries go first until they are used
+			fc.order.MoveToFront(fc.elems[key])
+		}
+		return nil, false
+	}
+
+	fc.replace(key, stored)
+	if !keep {
+		fc.discard(key, prev)
+		return nil, true
+	}
+	if old, err = fc.decode(prev); err != nil {
+		return nil, false
+	}
+	return old, true
+}
+
+// CompareAndDelete deletes the entry for the given arguments if its value equals
+// expected, and reports whether it did. Values are compared with the function set by
+// WithEqual, or with == for comparable values.
+func (fc *FunctionCache) CompareAndDelete(expected interface{}, args ...interface{}) bool {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return false
+	}
+	fc.lock()
+	defer fc.unlock()
+	if !fc.holds(key, expected) {
+		return false
+	}
+	fc.remove(key)
+	return true
+}
+
+// CompareAndSwap stores new for the given arguments if the current value equals old,
+// and reports whether it did. Values are compared like in CompareAndDelete. The
+// replaced value is released like with Set.
+func (fc *FunctionCache) CompareAndSwap(old, new interface{}, args ...interface{}) bool {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return false
+	}
+	stored, err := fc.encode(new)
+	if err != nil {
+		log.Printf("Encoding failed, not storing: %v, %v\n", key, err)
+		return false
+	}
+	fc.lock()
+	defer fc.unlock()
+	prev, _ := fc.lookup(key)
+	if !fc.holds(key, old) {
+		return false
+	}
+	fc.replace(key, stored)
+	fc.discard(key, prev)
+	return true
+}
+
+// holds reports whether the entry of key exists with a value equal to expected.
+// It must be called with fc.m held.
+func (fc *FunctionCache) holds(key string, expected interface{}) bool {
+	stored, found := fc.lookup(key)
+	if !found {
+		return false
+	}
+	value, err := fc.decode(stored)
+	if err != nil {
+		return false
+	}
+	if fc.equal != nil {
+		return fc.equal(value, expected)
+	}
+	if value == nil || expected == nil {
+		return value == expected
+	}
+	return same(value, expected)
+}
+
+// replace stores value in place of the existing entry of key without releasing the
+// old value, which the caller hands on or discards. The entry moves to the most recently used
+// position unless Set keeps the order. It must be called with fc.m held.
+func (fc *FunctionCache) replace(key string, value interface{}) {
+	fc.record(EventDelete, key)
+	fc.record(EventAdd, key)
+	fc.cache[key] = value
+	fc.entry[key] = time.Now()
+	fc.sources[key] = SourceSet
+	fc.markDirty(key, value, SourceSet)
+	if fc.states != nil {
+		fc.states[key] = stateFresh
+	}
+	fc.bytes -= int64(fc.sizes[key])
+	fc.sizes[key] = fc.sizeOf(value)
+	fc.bytes += int64(fc.sizes[key])
+	if !fc.setKeepsOrder {
+		fc.order.MoveToBack(fc.elems[key])
+	}
+}
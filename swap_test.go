@@ -0,0 +1,162 @@
+package cached
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test: Swap returns the old value and installs the new one
+func TestFunctionCacheSwap(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	if old, existed := fc.Swap("first", "key"); existed || old != nil {
+		t.Errorf("Expected no previous value, got %v, %v", old, existed)
+	}
+	if old, existed := fc.Swap("second", "key"); !existed || old != "first" {
+		t.Errorf("Expected the previous value, got %v, %v", old, existed)
+	}
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return "computed"
+	})
+	if result := cachedFunc("key"); result != "second" {
+		t.Errorf("Expected the swapped in value, got %v", result)
+	}
+}
+
+// Test: CompareAndDelete only deletes the expected value
+func TestFunctionCacheCompareAndDelete(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	fc.Set("stale", "key")
+	// The value is refreshed concurrently
+	fc.Set("fresh", "key")
+	if fc.CompareAndDelete("stale", "key") {
+		t.Errorf("Expected the refreshed value not to be deleted")
+	}
+	if fc.CompareAndDelete("fresh", "missing") {
+		t.Errorf("Expected nothing to be deleted for a missing entry")
+	}
+	if !fc.CompareAndDelete("fresh", "key") {
+		t.Errorf("Expected the expected value to be deleted")
+	}
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected an empty cache, got %d entries", size)
+	}
+}
+
+// Test: CompareAndSwap only replaces the expected value, using the equality function
+func TestFunctionCacheCompareAndSwap(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithEqual(func(a, b interface{}) bool {
+		return reflect.DeepEqual(a, b)
+	}))
+
+	fc.Set([]int{1}, "key")
+	if !fc.CompareAndSwap([]int{1}, []int{2}, "key") {
+		t.Errorf("Expected the swap of an equal value to succeed")
+	}
+	if fc.CompareAndSwap([]int{1}, []int{3}, "key") {
+		t.Errorf("Expected the swap of a changed value to fail")
+	}
+	if old, _ := fc.Swap(nil, "key"); !reflect.DeepEqual(old, []int{2}) {
+		t.Errorf("Expected the swapped value to be kept, got %v", old)
+	}
+}
+
+// Test: Set counts as a use under LRU unless configured not to
+func TestFunctionCacheSetBumpsRecency(t *testing.T) {
+	tests := []struct {
+		bump    bool
+		victims []string
+	}{
+		{true, []string{"b", "primed"}},
+		{false, []string{"primed", "a"}},
+	}
+	for _, tt := range tests {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fc := NewFunctionCache(ctx, WithMaxSize(3), WithEvictionPolicy(LRU), WithSetBumpsRecency(tt.bump))
+		cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+			return args[0]
+		})
+
+		cachedFunc("a")
+		cachedFunc("b")
+		fc.Set("p", "primed")
+		fc.Set("A", "a")
+
+		for i, arg := range []string{"c", "d"} {
+			cachedFunc(arg)
+			if _, found := fc.EntryInfo(tt.victims[i]); found {
+				t.Errorf("bump=%v: expected %v to be evicted by %v", tt.bump, tt.victims[i], arg)
+			}
+		}
+	}
+}
+
+// Test: A Set during an in-flight computation releases its waiters with the Set value
+func TestSetWakesWaiters(t *testing.T) {
+	for _, supersede := range []bool{true, false} {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fc := NewFunctionCache(ctx, WithSetWakesWaiters(supersede))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+			close(started)
+			<-release
+			return "computed"
+		})
+
+		leader := make(chan interface{})
+		go func() {
+			leader <- cachedFunc("k")
+		}()
+		<-started
+		waiters := make(chan interface{}, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				waiters <- cachedFunc("k")
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		fc.Set("set", "k")
+		for i := 0; i < 2; i++ {
+			select {
+			case result := <-waiters:
+				if result != "set" {
+					t.Errorf("Expected the waiter to get the Set value, got %v", result)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected the Set to release the waiters")
+			}
+		}
+
+		close(release)
+		if result := <-leader; result != "computed" {
+			t.Errorf("Expected the leader to get its own result, got %v", result)
+		}
+		want := "computed"
+		if supersede {
+			want = "set"
+		}
+		if result := cachedFunc("k"); result != want {
+			t.Errorf("Expected %v to be stored with supersede %v, got %v", want, supersede, result)
+		}
+	}
+}
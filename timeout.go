@@ -0,0 +1,51 @@
+package cached
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrComputeTimeout is returned when a computation takes longer than the compute timeout.
+var ErrComputeTimeout = errors.New("cached: computation timed out")
+
+// outcome is the result of a computation running in its own goroutine.
+type outcome struct {
+	result interface{}
+	err    error
+	panic  interface{}
+}
+
+// run calls compute, giving up after the compute timeout if one is set. A computation
+// that times out keeps running detached and its result is dropped.
+func (fc *FunctionCache) run(compute func() (interface{}, error)) (interface{}, error) {
+	if fc.timeout <= 0 {
+		return compute()
+	}
+
+	// Buffered so that a detached computation can always deliver and exit
+	ch := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		defer func() {
+			if r := recover(); r != nil {
+				o.panic = r
+			}
+			ch <- o
+		}()
+		o.result, o.err = compute()
+	}()
+
+	timer := time.NewTimer(fc.timeout)
+	defer timer.Stop()
+	select {
+	case o := <-ch:
+		if o.panic != nil {
+			// Panics surface in the leader like they would without a timeout
+			panic(o.panic)
+		}
+		return o.result, o.err
+	case <-timer.C:
+		return nil, fmt.Errorf("%w after %v", ErrComputeTimeout, fc.timeout)
+	}
+}
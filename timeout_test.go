@@ -0,0 +1,52 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test: Computations exceeding the timeout fail for the leader and its waiters
+func TestCachedFunctionComputeTimeout(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithComputeTimeout(50*time.Millisecond))
+
+	cachedFunc := fc.WrapE(func(args ...interface{}) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return args[0], nil
+	})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = cachedFunc(1)
+		}(i)
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected callers to give up after the timeout, took %v", elapsed)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, ErrComputeTimeout) {
+			t.Errorf("Expected a timeout error, got %v", err)
+		}
+	}
+	if len(fc.group.calls) != 0 {
+		t.Errorf("Expected the in-flight slot to be released, got %v", fc.group.calls)
+	}
+
+	// The detached computation finishing later does not populate the cache
+	time.Sleep(200 * time.Millisecond)
+	if size := fc.Stats().Size; size != 0 {
+		t.Errorf("Expected nothing to be cached, got %d entries", size)
+	}
+}
@@ -0,0 +1,92 @@
+package cached
+
+import (
+	"hash/fnv"
+	"log"
+)
+
+// sketchDepth is the number of rows of a count-min sketch.
+const sketchDepth = 4
+
+// sketch is a count-min sketch estimating how often keys were requested recently.
+// Counters saturate at 15 and are halved every time the sketch has counted ten
+// times its width, so that old popularity fades.
+type sketch struct {
+	counters []uint8
+	mask     uint64
+	adds     int
+	resetAt  int
+}
+
+// newSketch creates a sketch sized for a cache of capacity entries.
+func newSketch(capacity int) *sketch {
+	width := 16
+	for width < 4*capacity {
+		width *= 2
+	}
+	return &sketch{
+		counters: make([]uint8, sketchDepth*width),
+		mask:     uint64(width - 1),
+		resetAt:  10 * width,
+	}
+}
+
+// index returns the counter of key in row i.
+func (s *sketch) index(h1, h2 uint64, i int) uint64 {
+	return uint64(i)*(s.mask+1) + (h1+uint64(i)*h2)&s.mask
+}
+
+// hashes returns the two hashes of key the rows are derived from.
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	return h1, h1>>32 | 1
+}
+
+// add counts a request of key.
+func (s *sketch) add(key string) {
+	h1, h2 := hashes(key)
+	for i := 0; i < sketchDepth; i++ {
+		if c := &s.counters[s.index(h1, h2, i)]; *c < 15 {
+			*c++
+		}
+	}
+	if s.adds++; s.adds >= s.resetAt {
+		for i := range s.counters {
+			s.counters[i] /= 2
+		}
+		s.adds /= 2
+	}
+}
+
+// estimate returns the estimated number of recent requests of key.
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := hashes(key)
+	n := uint8(15)
+	for i := 0; i < sketchDepth; i++ {
+		n = min(n, s.counters[s.index(h1, h2, i)])
+	}
+	return n
+}
+
+// frequent reports whether the TinyLFU filter admits key: always while there is room,
+// and when the cache is full only if key was requested more often recently than the
+// entry the eviction policy would evict for it. It must be called with fc.m held.
+func (fc *FunctionCache) frequent(key string) bool {
+	if _, found := fc.cache[key]; found {
+		return true
+	}
+	part := fc.partitionOf(key)
+	if fc.size(part) < fc.capacity() {
+		return true
+	}
+	victims := fc.victims(1, func(k string) bool {
+		return fc.evictable(k, part)
+	})
+	if len(victims) == 0 || fc.sketch.estimate(key) > fc.sketch.estimate(victims[0]) {
+		return true
+	}
+	log.Printf("Not admitted by TinyLFU: %v, victim: %v\n", key, victims[0])
+	return false
+}
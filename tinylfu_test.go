@@ -0,0 +1,41 @@
+package cached
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// Test: TinyLFU admission beats plain LRU on a Zipfian trace at the same size
+func TestTinyLFUHitRate(t *testing.T) {
+	trace := make([]uint64, 20000)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(7)), 1.1, 1, 9999)
+	for i := range trace {
+		trace[i] = zipf.Uint64()
+	}
+
+	hitRate := func(opts ...Option) float64 {
+		// mock cache
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fc := NewFunctionCache(ctx, append(opts, WithMaxSize(100), WithEvictionPolicy(LRU))...)
+		cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+			return args[0]
+		})
+		for _, k := range trace {
+			cachedFunc(k)
+		}
+		stats := fc.Stats()
+		if stats.Size > 100 {
+			t.Errorf("Expected at most 100 entries, got %d", stats.Size)
+		}
+		return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+
+	lru := hitRate()
+	tinyLFU := hitRate(WithTinyLFU())
+	if tinyLFU <= lru {
+		t.Errorf("Expected TinyLFU to beat LRU, got %.3f vs %.3f", tinyLFU, lru)
+	}
+	t.Logf("Hit rate LRU: %.3f, TinyLFU: %.3f", lru, tinyLFU)
+}
@@ -0,0 +1,182 @@
+package cached
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errUncacheable is returned for results which are passed on without caching.
+var errUncacheable = errors.New("cached: result not cacheable")
+
+// cachedResponse is a response stored by a CachingTransport.
+type cachedResponse struct {
+	status     string
+	statusCode int
+	proto      string
+	header     http.Header
+	body       []byte
+}
+
+// CachingTransport is an http.RoundTripper serving identical GET and HEAD requests
+// from a FunctionCache. Requests are keyed on their method, URL and the values of
+// Headers. Requests with Authorization or Cookie headers not in Headers bypass the
+// cache. Only 200 responses with bodies of at most MaxBodySize bytes are cached, for
+// TTL, unless they are private, no-store or vary on headers not in Headers. Other
+// methods, responses and concurrent requests waiting for one of them go to Transport.
+type CachingTransport struct {
+	Transport   http.RoundTripper
+	Cache       *FunctionCache
+	TTL         time.Duration
+	MaxBodySize int64
+	Headers     []string
+}
+
+// NewCachingTransport creates a CachingTransport sending requests through next, or
+// http.DefaultTransport if next is nil.
+func NewCachingTransport(fc *FunctionCache, next http.RoundTripper, ttl time.Duration, maxBodySize int64, headers ...string) *CachingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &CachingTransport{
+		Transport:   next,
+		Cache:       fc,
+		TTL:         ttl,
+		MaxBodySize: maxBodySize,
+		Headers:     headers,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.Transport.RoundTrip(req)
+	}
+	for _, h := range credentialHeaders {
+		if req.Header.Get(h) != "" && !t.keyed(h) {
+			// Responses for one user's credentials must never be served to another
+			log.Printf("Request carries %v, not in the key, sending request: %v\n", h, req.URL)
+			return t.Transport.RoundTrip(req)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(req.Method + " " + req.URL.String())
+	for _, h := range t.Headers {
+		sb.WriteString("\n" + h + ": " + strings.Join(req.Header.Values(h), ","))
+	}
+	args := []interface{}{sb.String()}
+
+	// Only the leader's own response is set when it cannot be cached
+	var own *http.Response
+	result, err := t.Cache.do(args, func() (interface{}, error) {
+		resp, err := t.Transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK || !t.shareable(resp.Header) {
+			own = resp
+			return nil, errUncacheable
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, t.MaxBodySize+1))
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if int64(len(body)) > t.MaxBodySize {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			own = resp
+			return nil, errUncacheable
+		}
+		resp.Body.Close()
+		return &cachedResponse{
+			status:     resp.Status,
+			statusCode: resp.StatusCode,
+			proto:      resp.Proto,
+			header:     resp.Header,
+			body:       body,
+		}, nil
+	})
+	switch {
+	case own != nil:
+		return own, nil
+	case errors.Is(err, errUncacheable):
+		log.Printf("Response not cacheable, sending request: %v\n", args[0])
+		return t.Transport.RoundTrip(req)
+	case err != nil:
+		return nil, err
+	}
+	t.expireAfter(args)
+
+	cr := result.(*cachedResponse)
+	return &http.Response{
+		Status:        cr.status,
+		StatusCode:    cr.statusCode,
+		Proto:         cr.proto,
+		Header:        cr.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(cr.body)),
+		ContentLength: int64(len(cr.body)),
+		Request:       req,
+	}, nil
+}
+
+// credentialHeaders are the request headers identifying a user, which bypass the
+// cache unless they are part of the key.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// keyed reports whether the request header h is part of the key.
+func (t *CachingTransport) keyed(h string) bool {
+	h = http.CanonicalHeaderKey(h)
+	for _, k := range t.Headers {
+		if http.CanonicalHeaderKey(k) == h {
+			return true
+		}
+	}
+	return false
+}
+
+// shareable reports whether a response with header may be served to other requests
+// with the same key: it is neither private nor no-store, and it only varies on
+// request headers which are part of the key.
+func (t *CachingTransport) shareable(header http.Header) bool {
+	for _, v := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d == "no-store" || d == "private" || strings.HasPrefix(d, "private=") {
+				return false
+			}
+		}
+	}
+	for _, v := range header.Values("Vary") {
+		for _, h := range strings.Split(v, ",") {
+			h = strings.TrimSpace(h)
+			if h == "*" || h != "" && !t.keyed(h) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// expireAfter applies the TTL of the transport to the entry of args.
+func (t *CachingTransport) expireAfter(args []interface{}) {
+	if t.TTL <= 0 {
+		return
+	}
+	key, err := t.Cache.key(args)
+	if err != nil {
+		return
+	}
+	t.Cache.lock()
+	defer t.Cache.unlock()
+	if _, found := t.Cache.cache[key]; found {
+		t.Cache.ttls[key] = t.TTL
+	}
+}
@@ -0,0 +1,160 @@
+package cached
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Identical GET requests are served from the cache, other methods are not
+func TestCachingTransport(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		}
+		w.Header().Set("X-Method", r.Method)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	client := &http.Client{Transport: NewCachingTransport(fc, nil, time.Minute, 10)}
+
+	get := func(path string) string {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := get("/"); body != "hello" {
+		t.Errorf("Expected the response body, got %q", body)
+	}
+	if body := get("/"); body != "hello" {
+		t.Errorf("Expected the cached response body, got %q", body)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the second GET not to reach the server, got %d requests", requests)
+	}
+
+	// Bodies over the maximum size are passed on whole but not cached
+	if body := get("/large"); len(body) != 100 {
+		t.Errorf("Expected the whole large body, got %d bytes", len(body))
+	}
+	get("/large")
+	if requests != 3 {
+		t.Errorf("Expected large responses not to be cached, got %d requests", requests)
+	}
+
+	// Non-idempotent methods bypass the cache
+	client.Post(srv.URL+"/", "text/plain", nil)
+	client.Post(srv.URL+"/", "text/plain", nil)
+	if requests != 5 {
+		t.Errorf("Expected POST requests to bypass the cache, got %d requests", requests)
+	}
+}
+
+// Test: Cached responses are not served past the TTL of the transport
+func TestCachingTransportTTL(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	// mock cache, expiring through the sweeps only
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	client := &http.Client{Transport: NewCachingTransport(fc, nil, 30*time.Millisecond, 10)}
+	get := func() {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	get()
+	get()
+	time.Sleep(60 * time.Millisecond)
+	get()
+	if requests != 2 {
+		t.Errorf("Expected the response to be fetched again after the TTL, got %d requests", requests)
+	}
+}
+
+// Test: Responses are never shared between credentials or when marked private
+func TestCachingTransportPrivate(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/vary":
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Write([]byte("secret of " + r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+	client := &http.Client{Transport: NewCachingTransport(fc, nil, time.Minute, 100)}
+	get := func(path, auth string) string {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	get("/", "alice")
+	if body := get("/", "bob"); body != "secret of bob" || requests != 2 {
+		t.Errorf("Expected both credentials to reach the server, got %q after %d requests", body, requests)
+	}
+
+	for _, path := range []string{"/private", "/vary"} {
+		before := atomic.LoadInt32(&requests)
+		get(path, "")
+		get(path, "")
+		if n := atomic.LoadInt32(&requests) - before; n != 2 {
+			t.Errorf("Expected %v responses not to be cached, got %d requests for two GETs", path, n)
+		}
+	}
+
+	// Credentials in the key get entries of their own
+	keyed := &http.Client{Transport: NewCachingTransport(NewFunctionCache(ctx), nil, time.Minute, 100, "Authorization")}
+	client = keyed
+	before := atomic.LoadInt32(&requests)
+	get("/", "alice")
+	get("/", "alice")
+	if body := get("/", "bob"); body != "secret of bob" || atomic.LoadInt32(&requests)-before != 2 {
+		t.Errorf("Expected one request per credential, got %q after %d requests", body, atomic.LoadInt32(&requests)-before)
+	}
+}
@@ -0,0 +1,143 @@
+package cached
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrNotFound is returned by loaders for values that do not exist. Such results are
+// cached negatively, so repeated lookups of a missing value do not reach the loader.
+var ErrNotFound = errors.New("cached: not found")
+
+// Store is a single level of a TwoLevel cache.
+type Store interface {
+	// Get returns the value stored under key and whether it was found.
+	Get(key string) (interface{}, bool)
+	// Set stores value under key for ttl.
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+// negative marks a cached ErrNotFound result.
+type negative struct{}
+
+// TwoLevel is a read-through cache with an in-process first level (L1) and a shared
+// second level (L2), for example a FunctionCache in front of a remote store. Lookups
+// check L1, then L2, then compute, writing results back to L2 before L1. Values found
+// in L2 are promoted to L1. Negative results are only cached in L1.
+type TwoLevel struct {
+	L1          Store
+	L2          Store
+	L1TTL       time.Duration
+	L2TTL       time.Duration
+	NegativeTTL time.Duration
+	group       *Group
+}
+
+// NewTwoLevel creates a TwoLevel cache from the given levels and expiry times.
+func NewTwoLevel(l1, l2 Store, l1TTL, l2TTL, negativeTTL time.Duration) *TwoLevel {
+	return &TwoLevel{
+		L1:          l1,
+		L2:          l2,
+		L1TTL:       l1TTL,
+		L2TTL:       l2TTL,
+		NegativeTTL: negativeTTL,
+		group:       NewGroup(),
+	}
+}
+
+// Wrap creates a read-through version of the given loader. The loader reports missing
+// values with ErrNotFound, other errors are returned without being cached.
+func (tl *TwoLevel) Wrap(f func(args ...interface{}) (interface{}, error)) func(args ...interface{}) (interface{}, error) {
+	if f == nil {
+		panic("cached: TwoLevel.Wrap called with a nil function")
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		key := DefaultKey(args...)
+		if result, found := tl.L1.Get(key); found {
+			log.Printf("L1 hit: %v -> %v\n", key, result)
+			return tl.result(result)
+		}
+
+		result, err, _ := tl.group.Do(key, func() (interface{}, error) {
+			if result, found := tl.L2.Get(key); found {
+				log.Printf("L2 hit, promoting: %v -> %v\n", key, result)
+				tl.L1.Set(key, result, tl.L1TTL)
+				return result, nil
+			}
+
+			result, err := f(args...)
+			if errors.Is(err, ErrNotFound) {
+				log.Printf("Caching negative result in L1: %v\n", key)
+				tl.L1.Set(key, negative{}, tl.NegativeTTL)
+				return nil, err
+			}
+			if err != nil {
+				return nil, err
+			}
+			tl.L2.Set(key, result, tl.L2TTL)
+			tl.L1.Set(key, result, tl.L1TTL)
+			return result, nil
+		})
+		return result, err
+	}
+}
+
+// result turns a negative marker back into ErrNotFound.
+func (tl *TwoLevel) result(result interface{}) (interface{}, error) {
+	if _, ok := result.(negative); ok {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// isNegative reports whether the stored value is a negative marker.
+func (fc *FunctionCache) isNegative(value interface{}) bool {
+	if fc.weakValues {
+		value, _ = strengthen(value)
+	}
+	_, ok := value.(negative)
+	return ok
+}
+
+// AsStore returns a view of the cache usable as a Store, with a per-entry expiry time.
+func (fc *FunctionCache) AsStore() Store {
+	return fcStore{fc}
+}
+
+// fcStore adapts a FunctionCache to the Store interface.
+type fcStore struct {
+	fc *FunctionCache
+}
+
+// Get returns the unexpired value stored under key, or any while expiry is paused.
+func (s fcStore) Get(key string) (interface{}, bool) {
+	s.fc.lock()
+	result, found := s.fc.cache[key]
+	if !found || s.fc.paused == 0 && s.fc.isExpired(key) {
+		s.fc.misses.Add(1)
+		s.fc.publish(EventMiss, key)
+		s.fc.unlock()
+		return nil, false
+	}
+	s.fc.hits.Add(1)
+	s.fc.publish(EventHit, key)
+	s.fc.touch(key)
+	s.fc.unlock()
+
+	result, err := s.fc.decode(result)
+	return result, err == nil
+}
+
+// Set stores value under key, expiring it after ttl.
+func (s fcStore) Set(key string, value interface{}, ttl time.Duration) {
+	value, err := s.fc.encode(value)
+	if err != nil {
+		log.Printf("Encoding failed, not caching: %v, %v\n", key, err)
+		return
+	}
+	s.fc.lock()
+	defer s.fc.unlock()
+	s.fc.storeFrom(key, value, SourceStore)
+	s.fc.ttls[key] = ttl
+}
@@ -0,0 +1,160 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory Store recording the operations made on it
+type fakeStore struct {
+	m    sync.Mutex
+	name string
+	data map[string]interface{}
+	ops  *[]string
+}
+
+func newFakeStore(name string, ops *[]string) *fakeStore {
+	return &fakeStore{name: name, data: make(map[string]interface{}), ops: ops}
+}
+
+func (s *fakeStore) Get(key string) (interface{}, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *fakeStore) Set(key string, value interface{}, ttl time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.data[key] = value
+	*s.ops = append(*s.ops, fmt.Sprintf("%s.Set(%s, %v)", s.name, key, ttl))
+}
+
+// Test: Values are written back to both levels and promoted from L2
+func TestTwoLevelWriteBackAndPromotion(t *testing.T) {
+	var ops []string
+	l1 := newFakeStore("L1", &ops)
+	l2 := newFakeStore("L2", &ops)
+	tl := NewTwoLevel(l1, l2, time.Second, time.Minute, time.Millisecond)
+
+	var calls int
+
+	// Define a loader
+	f := func(args ...interface{}) (interface{}, error) {
+		calls++
+		return args[0], nil
+	}
+
+	// Create a read-through version of the loader
+	cachedFunc := tl.Wrap(f)
+
+	cachedFunc("a")
+	expected := []string{"L2.Set([a], 1m0s)", "L1.Set([a], 1s)"}
+	if fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("Expected write-back order %v, got %v", expected, ops)
+	}
+
+	// A value only present in L2 is promoted to L1 without calling the loader
+	ops = nil
+	l2.data["[b]"] = "b"
+	if result, err := cachedFunc("b"); result != "b" || err != nil {
+		t.Errorf("Expected value from L2, got %v, %v", result, err)
+	}
+	expected = []string{"L1.Set([b], 1s)"}
+	if fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("Expected promotion %v, got %v", expected, ops)
+	}
+	if calls != 1 {
+		t.Errorf("Expected loader to be called once, but it was called %d times", calls)
+	}
+}
+
+// Test: Negative results are cached only in L1
+func TestTwoLevelNegativeCaching(t *testing.T) {
+	// mock cache as L1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var ops []string
+	l2 := newFakeStore("L2", &ops)
+	tl := NewTwoLevel(fc.AsStore(), l2, time.Second, time.Minute, 50*time.Millisecond)
+
+	var calls int
+
+	// Define a loader which never finds anything
+	f := func(args ...interface{}) (interface{}, error) {
+		calls++
+		return nil, ErrNotFound
+	}
+
+	// Create a read-through version of the loader
+	cachedFunc := tl.Wrap(f)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cachedFunc("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected loader to be called once, but it was called %d times", calls)
+	}
+	if len(ops) != 0 {
+		t.Errorf("Expected negative result not to reach L2, got %v", ops)
+	}
+
+	// The negative entry expires after its own expiry time
+	time.Sleep(100 * time.Millisecond)
+	cachedFunc("missing")
+	if calls != 2 {
+		t.Errorf("Expected loader to be called again after the negative TTL, but it was called %d times", calls)
+	}
+}
+
+// Test: A flood of negatives evicts older negatives, not positive entries
+func TestTwoLevelMaxNegatives(t *testing.T) {
+	var ops []string
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l1 := NewFunctionCache(ctx, WithMaxSize(3), WithMaxNegatives(2))
+	tl := NewTwoLevel(l1.AsStore(), newFakeStore("L2", &ops), time.Minute, time.Minute, time.Minute)
+
+	var calls int
+	cachedFunc := tl.Wrap(func(args ...interface{}) (interface{}, error) {
+		calls++
+		if args[0].(int) < 0 {
+			return nil, ErrNotFound
+		}
+		return args[0], nil
+	})
+
+	for i := 1; i <= 3; i++ {
+		cachedFunc(i)
+	}
+	// Scan of non-existent keys
+	for i := 1; i <= 100; i++ {
+		cachedFunc(-i)
+	}
+
+	if stats := l1.Stats(); stats.Size != 5 {
+		t.Errorf("Expected 3 positives and 2 negatives, got %d entries", stats.Size)
+	}
+	calls = 0
+	for i := 1; i <= 3; i++ {
+		if result, err := cachedFunc(i); result != i || err != nil {
+			t.Errorf("Expected the positive entry, got %v, %v", result, err)
+		}
+	}
+	if _, err := cachedFunc(-100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the latest negative to be cached, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected all lookups to hit L1, loader was called %d times", calls)
+	}
+}
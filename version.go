@@ -0,0 +1,59 @@
+package cached
+
+import "log"
+
+// Versioned is a cached value with its version, e.g. the ETag of an upstream response.
+type Versioned struct {
+	Value   interface{}
+	Version string
+}
+
+// WrapVersioned creates a cached version of a function returning a value with its
+// version, e.g. an ETag, which is stored alongside the value. Cached versions can be
+// read with GetWithVersion to answer conditional requests without a computation.
+func (fc *FunctionCache) WrapVersioned(f func(args ...interface{}) (value interface{}, version string)) func(args ...interface{}) (interface{}, string) {
+	if f == nil {
+		panic("cached: WrapVersioned called with a nil function")
+	}
+	cached := fc.Wrap(func(args ...interface{}) interface{} {
+		value, version := f(args...)
+		return Versioned{Value: value, Version: version}
+	})
+	return func(args ...interface{}) (interface{}, string) {
+		v, _ := cached(args...).(Versioned)
+		return v.Value, v.Version
+	}
+}
+
+// GetWithVersion returns the cached value and version for the given arguments, stored
+// by a function wrapped with WrapVersioned, and whether there was one. It never
+// computes, so a miss can be answered by calling the wrapped function. Values stored
+// without a version are returned with an empty one.
+func (fc *FunctionCache) GetWithVersion(args ...interface{}) (value interface{}, version string, found bool) {
+	key, err := fc.key(fc.transformed(args))
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+		return nil, "", false
+	}
+	fc.lock()
+	stored, found := fc.lookup(key)
+	if !found || fc.paused == 0 && fc.isExpired(key) && !fc.serveStale(key) {
+		fc.misses.Add(1)
+		fc.publish(EventMiss, key)
+		fc.unlock()
+		return nil, "", false
+	}
+	fc.hits.Add(1)
+	fc.publish(EventHit, key)
+	fc.touch(key)
+	fc.unlock()
+
+	result, err := fc.decode(stored)
+	if err != nil {
+		return nil, "", false
+	}
+	if v, ok := result.(Versioned); ok {
+		return v.Value, v.Version, true
+	}
+	return result, "", true
+}
@@ -0,0 +1,41 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// Test: The version is stored and returned alongside the value
+func TestGetWithVersion(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	fetch := fc.WrapVersioned(func(args ...interface{}) (interface{}, string) {
+		calls++
+		return fmt.Sprintf("body of %v", args[0]), fmt.Sprintf(`"v%d"`, calls)
+	})
+
+	if _, _, found := fc.GetWithVersion("/a"); found {
+		t.Errorf("Expected no entry before the first call")
+	}
+	if value, version := fetch("/a"); value != "body of /a" || version != `"v1"` {
+		t.Errorf("Expected the value and its version, got %v, %v", value, version)
+	}
+	value, version, found := fc.GetWithVersion("/a")
+	if !found || value != "body of /a" || version != `"v1"` {
+		t.Errorf("Expected the stored value and version, got %v, %v, %v", value, version, found)
+	}
+	if calls != 1 {
+		t.Errorf("Expected GetWithVersion not to compute, function was called %d times", calls)
+	}
+
+	// Values stored without a version have an empty one
+	fc.Set("plain", "/b")
+	if value, version, found := fc.GetWithVersion("/b"); !found || value != "plain" || version != "" {
+		t.Errorf("Expected an unversioned value, got %v, %q, %v", value, version, found)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.24
+
+package cached
+
+import "weak"
+
+// box holds a value so that a weak pointer can refer to values of any type.
+type box struct {
+	value interface{}
+}
+
+// weakValue is the stored form of a value held weakly. Until loosen drops strong, it
+// also holds the box strongly, so new entries survive the GC cycles right after
+// they are stored.
+type weakValue struct {
+	ref    weak.Pointer[box]
+	strong *box
+}
+
+// weaken replaces value by a reference to it which is strong until loosened.
+func weaken(value interface{}) interface{} {
+	b := &box{value: value}
+	return weakValue{ref: weak.Make(b), strong: b}
+}
+
+// loosen drops the strong reference of a weak value, leaving the value to the GC.
+// Other values are returned unchanged.
+func loosen(value interface{}) interface{} {
+	if w, ok := value.(weakValue); ok {
+		w.strong = nil
+		return w
+	}
+	return value
+}
+
+// strengthen returns the value referenced by a weak reference, which fails once the
+// GC collected it. Other values are returned unchanged.
+func strengthen(value interface{}) (interface{}, error) {
+	w, ok := value.(weakValue)
+	if !ok {
+		return value, nil
+	}
+	b := w.ref.Value()
+	if b == nil {
+		return nil, errCollected
+	}
+	return b.value, nil
+}
+
+// weakSupported reports whether weak values are available.
+const weakSupported = true
@@ -0,0 +1,21 @@
+//go:build !go1.24
+
+package cached
+
+// weaken holds values strongly, weak references need the weak package of Go 1.24.
+func weaken(value interface{}) interface{} {
+	return value
+}
+
+// loosen returns value unchanged.
+func loosen(value interface{}) interface{} {
+	return value
+}
+
+// strengthen returns value unchanged.
+func strengthen(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+// weakSupported reports whether weak values are available.
+const weakSupported = false
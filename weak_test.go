@@ -0,0 +1,99 @@
+//go:build go1.24
+
+package cached
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: New weak values survive GC cycles, older ones collected by the GC are computed again
+func TestCachedFunctionWeakValues(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithWeakValues(), WithLazyExpiry(), WithTTL(time.Hour))
+
+	var calls int
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		calls++
+		return make([]byte, 1<<20)
+	})
+
+	value := cachedFunc(1)
+	cachedFunc(1)
+	if calls != 1 {
+		t.Errorf("Expected the value to be served until collected, function was called %d times", calls)
+	}
+	runtime.KeepAlive(value)
+
+	// Entries are held strongly until a sweep interval after they were stored
+	runtime.GC()
+	runtime.GC()
+	cachedFunc(1)
+	if calls != 1 {
+		t.Errorf("Expected a new value to survive the GC, function was called %d times", calls)
+	}
+
+	fc.lock()
+	fc.entry[fmt.Sprintf("%v", []interface{}{1})] = time.Now().Add(-CacheExpirySleepTime)
+	fc.unlock()
+	fc.ExpireNow()
+	runtime.GC()
+	runtime.GC()
+	cachedFunc(1)
+	if calls != 2 {
+		t.Errorf("Expected the collected value to be recomputed, function was called %d times", calls)
+	}
+	if stats := fc.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("Expected the collected value to count as a miss, got %+v", stats)
+	}
+}
+
+// Test: Weakly held values are released and measured as the values themselves
+func TestCachedFunctionWeakValuesRelease(t *testing.T) {
+	var evicted []interface{}
+
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithWeakValues(), WithOnEvict(func(key string, value interface{}) {
+		evicted = append(evicted, value)
+	}))
+
+	r := &resource{}
+	fc.Set(r, "closer")
+	fc.Set(strings.Repeat("x", 1000), "text")
+	if bytes := fc.Stats().Bytes; bytes < 1000 {
+		t.Errorf("Expected the size of the values, not of their references, got %d bytes", bytes)
+	}
+
+	fc.Delete("closer")
+	if len(evicted) != 1 || evicted[0] != r {
+		t.Errorf("Expected OnEvict to get the value itself, got %#v", evicted)
+	}
+	if n := atomic.LoadInt32(&r.closed); n != 1 {
+		t.Errorf("Expected the removed closer to be closed once, got %d", n)
+	}
+}
+
+// Test: The value size limit applies to weakly held values
+func TestCachedFunctionWeakValuesMaxBytes(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithWeakValues(), WithMaxValueBytes(100))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return strings.Repeat("x", 10000)
+	})
+	cachedFunc(1)
+	if stats := fc.Stats(); stats.Size != 0 || stats.Oversized != 1 {
+		t.Errorf("Expected the oversized value not to be cached, got %+v", stats)
+	}
+}
@@ -0,0 +1,34 @@
+package cached
+
+import (
+	"context"
+	"log"
+)
+
+// spawn runs fn in the background, through the background workers if configured.
+// When their queue is full fn is dropped and spawn reports false.
+func (fc *FunctionCache) spawn(fn func()) bool {
+	if fc.jobs == nil {
+		go fn()
+		return true
+	}
+	select {
+	case fc.jobs <- fn:
+		return true
+	default:
+		log.Printf("Background queue full, dropping job\n")
+		return false
+	}
+}
+
+// work runs queued background jobs until ctx is done.
+func (fc *FunctionCache) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case fn := <-fc.jobs:
+			fn()
+		}
+	}
+}
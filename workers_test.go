@@ -0,0 +1,48 @@
+package cached
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test: Background computations run on a bounded number of workers
+func TestCachedFunctionBackgroundWorkers(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx, WithBackgroundWorkers(2, 100), WithFirstMissFallback(func(args ...interface{}) interface{} {
+		return nil
+	}))
+
+	var running, peak int32
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return args[0]
+	})
+
+	// Every miss starts a background computation
+	for i := 0; i < 20; i++ {
+		cachedFunc(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fc.Stats().Size < 20 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if size := fc.Stats().Size; size != 20 {
+		t.Errorf("Expected all queued computations to complete, got %d entries", size)
+	}
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent background computations, got %d", peak)
+	}
+}
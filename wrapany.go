@@ -0,0 +1,117 @@
+package cached
+
+import (
+	"errors"
+	"log"
+	"reflect"
+)
+
+// errorType is the type of the error interface.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// WrapAny creates a cached version of fn, which may be a function of any signature,
+// and returns it as a function of the same type, e.g. a func(string, int) (*User,
+// error) wrapped by WrapAny can be asserted back to that type. Keys are built from
+// the arguments as for Wrap, a variadic tail being a single slice argument. When the
+// last result is an error, results are only cached if it is nil and waiters share
+// the error, like WrapE. Functions with several other results cache them together.
+// Argument transforms must keep the number and types of the arguments. WrapAny
+// panics if fn is not a function.
+func (fc *FunctionCache) WrapAny(fn interface{}) interface{} {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		panic("cached: WrapAny called with a non-function")
+	}
+	if v.IsNil() {
+		panic("cached: WrapAny called with a nil function")
+	}
+	t := v.Type()
+	results := t.NumOut()
+	hasErr := results > 0 && t.Out(results-1) == errorType
+	if hasErr {
+		results--
+	}
+
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		args := make([]interface{}, len(in))
+		for i, arg := range in {
+			args[i] = arg.Interface()
+		}
+		args = fc.transformed(args)
+		if len(args) != len(in) {
+			panic("cached: WrapAny argument transform changed the number of arguments")
+		}
+		for i := range in {
+			in[i] = valueOf(args[i], t.In(i))
+		}
+		call := func() []reflect.Value {
+			if t.IsVariadic() {
+				return v.CallSlice(in)
+			}
+			return v.Call(in)
+		}
+
+		result, err := fc.do(args, func() (interface{}, error) {
+			out := call()
+			if hasErr && !out[results].IsNil() {
+				return nil, out[results].Interface().(error)
+			}
+			return pack(out[:results]), nil
+		})
+		var kerr *KeyError
+		if errors.Is(err, ErrTooManyWaiters) || errors.Is(err, ErrRecursiveCall) || errors.As(err, &kerr) {
+			return call()
+		}
+
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		switch {
+		case err != nil && hasErr:
+			out[results] = valueOf(err, errorType)
+		case err != nil:
+			log.Printf("No result available, returning zero values: %v\n", err)
+		default:
+			for i, r := range unpack(result, results) {
+				out[i] = valueOf(r, t.Out(i))
+			}
+		}
+		return out
+	}).Interface()
+}
+
+// pack turns the results of a function into the value cached for them.
+func pack(out []reflect.Value) interface{} {
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0].Interface()
+	}
+	values := make([]interface{}, len(out))
+	for i, o := range out {
+		values[i] = o.Interface()
+	}
+	return values
+}
+
+// unpack returns the n results packed into value by pack.
+func unpack(value interface{}, n int) []interface{} {
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		return []interface{}{value}
+	}
+	return value.([]interface{})
+}
+
+// valueOf returns x as a value of type t, the zero value if x is nil.
+func valueOf(x interface{}, t reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	if x != nil {
+		v.Set(reflect.ValueOf(x))
+	}
+	return v
+}
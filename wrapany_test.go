@@ -0,0 +1,102 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Test: Functions of various signatures are cached and keep their type
+func TestWrapAny(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	var calls int
+	upper := fc.WrapAny(func(s string) string {
+		calls++
+		return strings.ToUpper(s)
+	}).(func(string) string)
+	for i := 0; i < 3; i++ {
+		if got := upper("a"); got != "A" {
+			t.Errorf("Expected A, got %v", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected function to be called once, but it was called %d times", calls)
+	}
+
+	// Several results are cached together
+	calls = 0
+	divmod := fc.WrapAny(func(a, b int) (int, int) {
+		calls++
+		return a / b, a % b
+	}).(func(int, int) (int, int))
+	for i := 0; i < 3; i++ {
+		if q, r := divmod(7, 2); q != 3 || r != 1 {
+			t.Errorf("Expected 3, 1, got %v, %v", q, r)
+		}
+	}
+	if q, r := divmod(9, 4); q != 2 || r != 1 || calls != 2 {
+		t.Errorf("Expected 2, 1 from a second call, got %v, %v after %d calls", q, r, calls)
+	}
+
+	// Variadic functions are keyed on their whole tail
+	calls = 0
+	join := fc.WrapAny(func(sep string, parts ...string) string {
+		calls++
+		return strings.Join(parts, sep)
+	}).(func(string, ...string) string)
+	join("-", "a", "b")
+	if got := join("-", "a", "b"); got != "a-b" || calls != 1 {
+		t.Errorf("Expected a-b from the cache, got %v after %d calls", got, calls)
+	}
+	if got := join("-", "a", "c"); got != "a-c" || calls != 2 {
+		t.Errorf("Expected a-c to be computed, got %v after %d calls", got, calls)
+	}
+}
+
+// Test: Errors of wrapped functions are returned but not cached
+func TestWrapAnyError(t *testing.T) {
+	// mock cache
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := NewFunctionCache(ctx)
+
+	type user struct{ name string }
+	var calls int
+	errNotFound := errors.New("not found")
+	find := fc.WrapAny(func(id int) (*user, error) {
+		calls++
+		if id < 0 {
+			return nil, errNotFound
+		}
+		return &user{name: fmt.Sprint("user", id)}, nil
+	}).(func(int) (*user, error))
+
+	first, err := find(1)
+	if err != nil || first.name != "user1" {
+		t.Fatalf("Expected user1, got %v, %v", first, err)
+	}
+	if again, _ := find(1); again != first || calls != 1 {
+		t.Errorf("Expected the cached user, got %v after %d calls", again, calls)
+	}
+	for i := 0; i < 2; i++ {
+		if u, err := find(-1); u != nil || !errors.Is(err, errNotFound) {
+			t.Errorf("Expected the error, got %v, %v", u, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected errors not to be cached, function was called %d times", calls)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected WrapAny to panic on a non-function")
+		}
+	}()
+	fc.WrapAny(42)
+}
@@ -0,0 +1,87 @@
+package cached
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Saver writes cache entries to an external store, see WithWriteBack.
+type Saver interface {
+	// Save writes value under key.
+	Save(key string, value interface{}) error
+}
+
+// SaverFunc adapts a function to the Saver interface.
+type SaverFunc func(key string, value interface{}) error
+
+// Save calls f(key, value).
+func (f SaverFunc) Save(key string, value interface{}) error {
+	return f(key, value)
+}
+
+// markDirty queues the value stored under key to be written back, replacing a write
+// still pending for it. It must be called with fc.m held.
+func (fc *FunctionCache) markDirty(key string, value interface{}, src Source) {
+	if fc.saver == nil || src == SourceSnapshot || fc.isNegative(value) {
+		return
+	}
+	fc.dirty[key] = value
+}
+
+// Sync writes all pending entries to the saver of a write-back cache and returns the
+// first error. Entries failing to save stay pending, unless they were written again
+// meanwhile, and are retried by the next flush.
+func (fc *FunctionCache) Sync() error {
+	if fc.saver == nil {
+		return nil
+	}
+	// One flush at a time, so that an older value never overwrites a newer one
+	fc.syncM.Lock()
+	defer fc.syncM.Unlock()
+
+	fc.lock()
+	dirty := fc.dirty
+	fc.dirty = make(map[string]interface{})
+	fc.unlock()
+
+	var first error
+	for key, stored := range dirty {
+		value, err := fc.decode(stored)
+		if err == nil {
+			err = fc.saver.Save(key, value)
+		}
+		if err == nil {
+			continue
+		}
+		log.Printf("Writing back failed, retrying later: %v, %v\n", key, err)
+		if first == nil {
+			first = err
+		}
+		fc.lock()
+		if _, found := fc.dirty[key]; !found {
+			fc.dirty[key] = stored
+		}
+		fc.unlock()
+	}
+	return first
+}
+
+// writeBackEvery flushes the pending entries every interval until ctx is done.
+func (fc *FunctionCache) writeBackEvery(ctx context.Context, interval time.Duration) {
+	defer close(fc.saved)
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fc.Sync()
+	}
+}
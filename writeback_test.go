@@ -0,0 +1,64 @@
+package cached
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapSaver is a Saver recording the saved values.
+type mapSaver struct {
+	mu    sync.Mutex
+	saved map[string]interface{}
+}
+
+func (s *mapSaver) Save(key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved[key] = value
+	return nil
+}
+
+func (s *mapSaver) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.saved)
+}
+
+// Test: Dirty entries are written back on the interval and the rest on Close
+func TestWriteBack(t *testing.T) {
+	// mock cache
+	saver := &mapSaver{saved: make(map[string]interface{})}
+	fc := NewFunctionCache(context.Background(), WithWriteBack(saver, 50*time.Millisecond))
+
+	cachedFunc := fc.Wrap(func(args ...interface{}) interface{} {
+		return args[0]
+	})
+	cachedFunc(1)
+	cachedFunc(2)
+	if n := saver.len(); n != 0 {
+		t.Errorf("Expected no synchronous writes, got %d", n)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if n := saver.len(); n != 2 {
+		t.Errorf("Expected the dirty entries to be flushed on the interval, got %d", n)
+	}
+
+	// Entries written right before a clean shutdown are not lost, even if removed
+	cachedFunc(3)
+	fc.Set("updated", 1)
+	fc.Delete(2)
+	fc.Close()
+	key := func(args ...interface{}) string {
+		return fmt.Sprintf("%v", args)
+	}
+	want := map[string]interface{}{key(1): "updated", key(2): 2, key(3): 3}
+	for k, v := range want {
+		if saver.saved[k] != v {
+			t.Errorf("Expected %v to be saved as %v, got %v", k, v, saver.saved[k])
+		}
+	}
+}